@@ -23,9 +23,19 @@ import (
 // Copy the result back out
 func main() {
 	versionFlag := flag.Bool("version", false, "version prints the version info of canticle")
+	offlineFlag := flag.Bool("offline", false, "offline prevents any command from accessing the network")
+	fetchFlag := flag.String("fetch-gopath", os.Getenv("CANTICLE_FETCH_GOPATH"), "fetch-gopath is the entry of a GOPATH list new packages are fetched into")
+	dirtyFlag := flag.String("dirty", string(canticles.DirtyRefuse), "dirty is refuse, stash or force for repos with uncommitted changes")
 	flag.Usage = usage
 	flag.Parse()
 	log.SetFlags(0)
+	canticles.Offline = *offlineFlag
+	canticles.FetchGoPath = *fetchFlag
+	dirty, err := canticles.ParseDirtyPolicy(*dirtyFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	canticles.Dirty = dirty
 
 	if *versionFlag {
 		b, err := json.MarshalIndent(buildinfo.GetBuildInfo(), "", "    ")
@@ -56,13 +66,25 @@ func main() {
 var UsageTemplate = `Canticle is a tool for managing go dependencies.
 
 Usage:
-  cant command [arguments]
+  cant [-offline] [-fetch-gopath <dir>] [-dirty <policy>] command [arguments]
 
 The commands are:
 {{range .}}
          {{.Name | printf "%-11s"}} {{.ShortDescription}}{{end}}
 
 Use "cant help [command]" for more information about that command.
+
+Use -offline to fail any operation that would access the network,
+only repos on disk and cached resolutions will be used.
+
+GOPATH may be a list. Packages are looked up in each entry in order
+and new packages are fetched into the first, use -fetch-gopath or
+$CANTICLE_FETCH_GOPATH to fetch into another entry.
+
+Repos with uncommitted changes or untracked files are never checked
+out or updated to another revision, the affected repos are listed
+instead. Use -dirty stash to stash the changes first or -dirty force
+to change the revision anyway.
 `
 
 func usage() {
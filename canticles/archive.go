@@ -0,0 +1,288 @@
+package canticles
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveMarkerFile is written to the root of an extracted archive
+// to record where it came from.
+const ArchiveMarkerFile = ".canticle-archive"
+
+// ArchiveRepoResolver resolves repos to gzipped tarballs. URL is a
+// template where {root} is replaced with the repo root and {rev}
+// with the requested revision, for example
+// https://archive.example.com/{root}/{rev}.tar.gz or
+// file:///srv/archives/{root}.tar.gz.
+type ArchiveRepoResolver struct {
+	Gopath string
+	URL    string
+}
+
+// NewArchiveRepoResolver returns an ArchiveRepoResolver for the url
+// template, which must contain {root}.
+func NewArchiveRepoResolver(gopath, url string) (*ArchiveRepoResolver, error) {
+	if !strings.Contains(url, "{root}") {
+		return nil, fmt.Errorf("archive url %q must contain {root}", url)
+	}
+	return &ArchiveRepoResolver{Gopath: gopath, URL: url}, nil
+}
+
+// ResolveRepo on an ArchiveRepoResolver checks each possible root of
+// importPath, shortest first, for an archive. If the url requires a
+// revision that is not known no archive can be checked and the repo
+// is not resolved.
+func (ar *ArchiveRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	rev := ""
+	if dep != nil {
+		rev = dep.Revision
+	}
+	roots := candidateRoots(importPath, dep)
+	re := NewResolutionFailureError(importPath, "archive")
+	for _, root := range roots {
+		av := &ArchiveVCS{Root: root, URL: strings.Replace(ar.URL, "{root}", root, -1), Gopath: ar.Gopath}
+		url, err := av.archiveURL(rev)
+		if err == nil {
+			if err = archiveExists(url); err == nil {
+				return av, nil
+			}
+		}
+		re.Attempts = append(re.Attempts, &ResolutionAttempt{
+			Resolver:   "archive",
+			ImportPath: importPath,
+			URL:        url,
+			Err:        err,
+		})
+	}
+	return nil, re
+}
+
+// archiveExists returns nil if the archive at url can be fetched.
+func archiveExists(url string) error {
+	if !isHTTPURL(url) {
+		_, err := os.Stat(archivePath(url))
+		return err
+	}
+	if Offline {
+		return &OfflineError{"check archive " + url}
+	}
+	resp, err := http.Head(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("archive %s returned status %s", url, resp.Status)
+	}
+	return nil
+}
+
+func isHTTPURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+func archivePath(url string) string {
+	return strings.TrimPrefix(url, "file://")
+}
+
+// archiveMarker is the content of an ArchiveMarkerFile.
+type archiveMarker struct {
+	URL      string
+	Revision string `json:",omitempty"`
+}
+
+// An ArchiveVCS fetches a repo by extracting a gzipped tarball into
+// the gopath. It is not a real VCS: branches are not supported and
+// the revision is the one the archive was fetched at.
+type ArchiveVCS struct {
+	Root   string
+	URL    string
+	Gopath string
+}
+
+func (av *ArchiveVCS) archiveURL(rev string) (string, error) {
+	if !strings.Contains(av.URL, "{rev}") {
+		return av.URL, nil
+	}
+	if rev == "" {
+		return av.URL, fmt.Errorf("archive url %s requires a revision", av.URL)
+	}
+	return strings.Replace(av.URL, "{rev}", rev, -1), nil
+}
+
+func (av *ArchiveVCS) marker() (*archiveMarker, error) {
+	b, err := ioutil.ReadFile(filepath.Join(PackageSource(av.Gopath, av.Root), ArchiveMarkerFile))
+	if err != nil {
+		return nil, err
+	}
+	var m archiveMarker
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Create extracts the archive for rev into the gopath. If the
+// destination already holds this archive at rev nothing is done.
+func (av *ArchiveVCS) Create(rev string) error {
+	url, err := av.archiveURL(rev)
+	if err != nil {
+		return err
+	}
+	dest := PackageSource(av.Gopath, av.Root)
+	if _, err := os.Stat(dest); err == nil {
+		m, err := av.marker()
+		if err != nil {
+			return fmt.Errorf("destination %s exists and was not fetched from an archive", dest)
+		}
+		if m.URL == url {
+			return nil
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+	}
+	LogVerbose("Fetching archive %s into %s", url, dest)
+	r, err := openArchive(url)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := extractTarGz(r, dest); err != nil {
+		os.RemoveAll(dest)
+		return fmt.Errorf("cant extract archive %s %s", url, err.Error())
+	}
+	b, err := json.Marshal(&archiveMarker{URL: url, Revision: rev})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dest, ArchiveMarkerFile), b, 0644)
+}
+
+// SetRev re-extracts the archive at rev if it differs from the
+// current one.
+func (av *ArchiveVCS) SetRev(rev string) error {
+	if rev == "" {
+		return nil
+	}
+	return av.Create(rev)
+}
+
+// GetRev returns the revision the archive was extracted at.
+func (av *ArchiveVCS) GetRev() (string, error) {
+	m, err := av.marker()
+	if err != nil {
+		return "", err
+	}
+	return m.Revision, nil
+}
+
+// GetBranch is not supported by archives and will return an error.
+func (av *ArchiveVCS) GetBranch() (string, error) {
+	return "", errors.New("archive VCS does not support GetBranch")
+}
+
+// UpdateBranch on an archive never updates.
+func (av *ArchiveVCS) UpdateBranch(branch string) (bool, string, error) {
+	return false, "", nil
+}
+
+// GetSource returns the archive url template for this root.
+func (av *ArchiveVCS) GetSource() (string, error) {
+	return av.URL, nil
+}
+
+// GetRoot returns the root of this archive.
+func (av *ArchiveVCS) GetRoot() string {
+	return av.Root
+}
+
+func openArchive(url string) (io.ReadCloser, error) {
+	if !isHTTPURL(url) {
+		return os.Open(archivePath(url))
+	}
+	if Offline {
+		return nil, &OfflineError{"fetch archive " + url}
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("archive %s returned status %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// extractTarGz extracts r into dest. If every entry shares a single
+// top level directory (as with most hosted tarballs) it is stripped.
+func extractTarGz(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tmp, err := ioutil.TempDir("", "cant-archive")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %s is outside the archive", hdr.Name)
+		}
+		target := filepath.Join(tmp, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	src := tmp
+	if entries, err := ioutil.ReadDir(tmp); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		src = filepath.Join(tmp, entries[0].Name())
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	dc := NewDirCopier(src, dest)
+	dc.CopyDot = true
+	return dc.Copy()
+}
@@ -0,0 +1,106 @@
+package canticles
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, path string, files map[string]string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Error creating archive dir: %s", err.Error())
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Error creating archive: %s", err.Error())
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Error writing archive header: %s", err.Error())
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("Error writing archive: %s", err.Error())
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Error closing archive: %s", err.Error())
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Error closing archive: %s", err.Error())
+	}
+}
+
+func TestArchiveRepoResolver(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-archive")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	archives := filepath.Join(testHome, "archives")
+	gopath := filepath.Join(testHome, "go")
+	writeTestArchive(t, filepath.Join(archives, "test.com", "arch", "v1.tar.gz"), map[string]string{
+		"arch-v1/arch.go":        "package arch\n",
+		"arch-v1/child/child.go": "package child\n",
+	})
+	writeTestArchive(t, filepath.Join(archives, "test.com", "arch", "v2.tar.gz"), map[string]string{
+		"arch-v2/arch.go": "package arch // v2\n",
+	})
+
+	ar, err := NewArchiveRepoResolver(gopath, "file://"+archives+"/{root}/{rev}.tar.gz")
+	if err != nil {
+		t.Fatalf("NewArchiveRepoResolver returned error for valid url: %s", err.Error())
+	}
+	dep := &CanticleDependency{Root: "test.com/arch", Revision: "v1"}
+	v, err := ar.ResolveRepo("test.com/arch/child", dep)
+	if err != nil {
+		t.Fatalf("ArchiveRepoResolver returned error for present archive: %s", err.Error())
+	}
+	if v.GetRoot() != "test.com/arch" {
+		t.Errorf("ArchiveRepoResolver returned root %s", v.GetRoot())
+	}
+	if err := v.Create("v1"); err != nil {
+		t.Fatalf("ArchiveVCS error creating: %s", err.Error())
+	}
+	if _, err := os.Stat(PackageSource(gopath, "test.com/arch/child/child.go")); err != nil {
+		t.Errorf("ArchiveVCS did not extract stripped archive: %s", err.Error())
+	}
+	rev, err := v.GetRev()
+	if err != nil || rev != "v1" {
+		t.Errorf("ArchiveVCS GetRev returned %s %v", rev, err)
+	}
+	if err := v.Create("v1"); err != nil {
+		t.Errorf("ArchiveVCS error creating already present archive: %s", err.Error())
+	}
+
+	if err := v.SetRev("v2"); err != nil {
+		t.Fatalf("ArchiveVCS error setting rev: %s", err.Error())
+	}
+	b, err := ioutil.ReadFile(PackageSource(gopath, "test.com/arch/arch.go"))
+	if err != nil || string(b) != "package arch // v2\n" {
+		t.Errorf("ArchiveVCS SetRev did not extract new revision %s %v", b, err)
+	}
+	if _, err := os.Stat(PackageSource(gopath, "test.com/arch/child")); !os.IsNotExist(err) {
+		t.Errorf("ArchiveVCS SetRev left files from old revision")
+	}
+
+	if _, err := ar.ResolveRepo("test.com/nothere", &CanticleDependency{Root: "test.com/nothere", Revision: "v1"}); err == nil {
+		t.Errorf("ArchiveRepoResolver returned no error for missing archive")
+	}
+	if _, err := ar.ResolveRepo("test.com/arch", &CanticleDependency{Root: "test.com/arch"}); err == nil {
+		t.Errorf("ArchiveRepoResolver returned no error for an archive without a revision")
+	}
+	if err := os.MkdirAll(PackageSource(gopath, "test.com/vcs"), 0755); err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	av := &ArchiveVCS{Root: "test.com/vcs", URL: "file://" + archives + "/test.com/arch/{rev}.tar.gz", Gopath: gopath}
+	if err := av.Create("v1"); err == nil {
+		t.Errorf("ArchiveVCS overwrote directory not created from an archive")
+	}
+}
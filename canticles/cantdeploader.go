@@ -2,6 +2,9 @@ package canticles
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -15,14 +18,23 @@ type CantDepReader interface {
 // set of CanticleDependencies. It uses a reader for fetchpath to read
 // the dependencies in a path and a resolver to resolve the vcs for
 // each path and actually fetch the dep. Update can be set to udpate
-// branches for a dep.
+// branches for a dep. If Scopes is not empty only deps in those
+// scopes are fetched. If Recursive is set the Canticle files of
+// fetched deps are read and their deps fetched too, with Conflicts
+// choosing between the revisions and sources they disagree on, and
+// then any go imports still missing are fetched by walking them with
+// Imports.
 type CanticleDepLoader struct {
-	Reader   CantDepReader
-	Resolver RepoResolver
-	Gopath   string
-	Update   bool
-	updated  map[string]string
-	Limit    int
+	Reader    CantDepReader
+	Resolver  RepoResolver
+	Gopath    string
+	Update    bool
+	updated   map[string]string
+	Limit     int
+	Scopes    StringSet
+	Recursive bool
+	Conflicts ConflictResolver
+	Imports   DependencyReader
 }
 
 // FetchPath fetches the dependencies in a Canticle file at path. It
@@ -39,7 +51,210 @@ func (cdl *CanticleDepLoader) FetchPath(path string) []error {
 		return []error{fmt.Errorf("cant fetch package %s couldn't read cant file %s", pkg, err.Error())}
 	}
 	LogVerbose("Read package canticle %s deps", pkg)
-	return cdl.FetchDeps(cdeps...)
+	inScope := make([]*CanticleDependency, 0, len(cdeps))
+	for _, cdep := range cdeps {
+		if !cdep.InScopes(cdl.Scopes) {
+			LogVerbose("Skipping %s dep %s", cdep.DepScope(), cdep.Root)
+			continue
+		}
+		inScope = append(inScope, cdep)
+	}
+	if cdl.Recursive {
+		if errs := cdl.FetchRecursive(pkg, inScope...); len(errs) > 0 {
+			return errs
+		}
+		if cdl.Imports == nil {
+			return nil
+		}
+		if err := cdl.FetchImports(pkg); err != nil {
+			return []error{err}
+		}
+		return nil
+	}
+	return cdl.FetchDeps(inScope...)
+}
+
+// FetchRecursive fetches cdeps, the deps of pkg, and then the runtime
+// deps in the Canticle files of every dep fetched until no new deps
+// or revisions are found. Each round is fetched in parallel with
+// FetchDeps. The deps of pkg are never overridden, other deps wanted
+// at more than one revision or source are resolved with Conflicts
+// and fetched again if their resolution changed. Updated returns the
+// updates from all rounds.
+func (cdl *CanticleDepLoader) FetchRecursive(pkg string, cdeps ...*CanticleDependency) []error {
+	pinned := NewStringSet()
+	pinned.Add(pkg)
+	for _, cdep := range cdeps {
+		pinned.Add(cdep.Root)
+	}
+	// wants maps each root to the deps wanting it by requesting root
+	wants := make(map[string]map[string]*CanticleDependency)
+	chosen := make(map[string]*CanticleDependency)
+	fetched := make(map[string]StringSet)
+	updated := make(map[string]string)
+	defer func() { cdl.updated = updated }()
+	for pending := cdeps; len(pending) > 0; {
+		errs := cdl.FetchDeps(pending...)
+		for root, rev := range cdl.updated {
+			updated[root] = rev
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		changed := NewStringSet()
+		for _, cdep := range pending {
+			chosen[cdep.Root] = cdep
+			if fetched[cdep.Root] == nil {
+				fetched[cdep.Root] = NewStringSet()
+			}
+			fetched[cdep.Root].Add(cdep.Revision + "@" + cdep.SourcePath)
+			children, err := cdl.childDeps(cdep)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for root, from := range wants {
+				if _, ok := from[cdep.Root]; ok {
+					delete(from, cdep.Root)
+					changed.Add(root)
+				}
+			}
+			for _, child := range children {
+				if pinned[child.Root] {
+					LogVerbose("Not overriding %s from %s with %s", child.Root, cdep.Root, child.Revision)
+					continue
+				}
+				if wants[child.Root] == nil {
+					wants[child.Root] = make(map[string]*CanticleDependency)
+				}
+				wants[child.Root][cdep.Root] = child
+				changed.Add(child.Root)
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		resolved, err := cdl.resolveWants(changed, wants, chosen)
+		if err != nil {
+			return []error{err}
+		}
+		pending = nil
+		for _, cdep := range resolved {
+			current := chosen[cdep.Root]
+			if current != nil && current.Revision == cdep.Revision && current.SourcePath == cdep.SourcePath {
+				continue
+			}
+			if fetched[cdep.Root][cdep.Revision+"@"+cdep.SourcePath] {
+				return []error{fmt.Errorf("cant resolve %s, its deps keep changing its revision back to %s", cdep.Root, cdep.Revision)}
+			}
+			LogVerbose("Fetching %s at %s wanted by deps", cdep.Root, cdep.Revision)
+			pending = append(pending, cdep)
+		}
+	}
+	return nil
+}
+
+// FetchImports walks the go imports of pkg and of every package it
+// imports, as vendor does, fetching those not on disk at the default
+// revision of their VCS. Repos already on disk are left as they are.
+// Repos fetched are warned about as no Canticle file pins them.
+func (cdl *CanticleDepLoader) FetchImports(pkg string) error {
+	dl := NewDependencyLoader(cdl.Resolver, cdl.Imports, nil, cdl.Gopath)
+	dw := NewDependencyWalker(dl.PackageImports, dl.FetchUpdatePackage)
+	if err := dw.TraverseDependencies(pkg); err != nil {
+		return fmt.Errorf("cant fetch imports of %s %s", pkg, err.Error())
+	}
+	if unpinned := dl.Unpinned(); len(unpinned) > 0 {
+		LogWarn("Fetched %d imported repos with no pinned revision, at their default branch:\n\t%s", len(unpinned), strings.Join(unpinned, "\n\t"))
+	}
+	return nil
+}
+
+// childDeps returns the runtime deps in the Canticle file of cdep
+// in the scope of cdep.
+func (cdl *CanticleDepLoader) childDeps(cdep *CanticleDependency) ([]*CanticleDependency, error) {
+	deps, err := cdl.Reader.CanticleDependencies(cdep.Root)
+	if err != nil && os.IsNotExist(err) {
+		LogVerbose("Dep %s has no Canticle file", cdep.Root)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cant read Canticle file of dep %s %s", cdep.Root, err.Error())
+	}
+	children := make([]*CanticleDependency, 0, len(deps))
+	for _, dep := range deps {
+		if dep.DepScope() != ScopeRuntime {
+			LogVerbose("Skipping %s dep %s of %s", dep.DepScope(), dep.Root, cdep.Root)
+			continue
+		}
+		child := *dep
+		child.Scope = cdep.Scope
+		if child.InScopes(cdl.Scopes) {
+			children = append(children, &child)
+		}
+	}
+	return children, nil
+}
+
+// resolveWants resolves the deps of changed roots to the single
+// revision and source wanted, or with Conflicts if they conflict. The
+// resolution keeps the Hash and Signature of a dep wanting it.
+func (cdl *CanticleDepLoader) resolveWants(changed StringSet, wants map[string]map[string]*CanticleDependency, chosen map[string]*CanticleDependency) ([]*CanticleDependency, error) {
+	conflicts := NewDependencySources(0)
+	var resolved []*CanticleDependency
+	for _, root := range changed.Array() {
+		if len(wants[root]) == 0 {
+			continue
+		}
+		source := NewDependencySource(root)
+		for from, cdep := range wants[root] {
+			source.AddCantSource(cdep, from)
+		}
+		if current := chosen[root]; current != nil {
+			source.OnDiskRevision = current.Revision
+			source.OnDiskSource = current.SourcePath
+		}
+		if cd := resolveUnconflicted(source); cd != nil {
+			resolved = append(resolved, cd)
+			continue
+		}
+		conflicts.AddSource(source)
+	}
+	if len(conflicts.Sources) > 0 {
+		if cdl.Conflicts == nil {
+			return nil, &ConflictError{conflicts.Sources}
+		}
+		cds, err := cdl.Conflicts.ResolveConflicts(conflicts)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, cds...)
+	}
+	for i, cd := range resolved {
+		resolved[i] = wantedDep(cd, wants[cd.Root])
+	}
+	return resolved, nil
+}
+
+// wantedDep returns a copy of the dep in from matching the revision
+// and source of cd, or cd if none match.
+func wantedDep(cd *CanticleDependency, from map[string]*CanticleDependency) *CanticleDependency {
+	requesters := make([]string, 0, len(from))
+	for requester := range from {
+		requesters = append(requesters, requester)
+	}
+	sort.Strings(requesters)
+	for _, requester := range requesters {
+		want := from[requester]
+		if want.Revision == cd.Revision && want.SourcePath == cd.SourcePath {
+			dep := *want
+			return &dep
+		}
+	}
+	if len(requesters) > 0 {
+		cd.Scope = from[requesters[0]].Scope
+	}
+	return cd
 }
 
 type update struct {
@@ -48,7 +263,8 @@ type update struct {
 	err  error
 }
 
-// FetchDeps will fetch all of the cdeps passed to it in parallel and
+// FetchDeps will fetch all of the cdeps passed to it in parallel,
+// verifying the Hash of any locked deps not updated from a branch, and
 // return an array of encountered errors.
 func (cdl *CanticleDepLoader) FetchDeps(cdeps ...*CanticleDependency) []error {
 	cdl.updated = make(map[string]string, len(cdeps))
@@ -65,6 +281,10 @@ func (cdl *CanticleDepLoader) FetchDeps(cdeps ...*CanticleDependency) []error {
 		go func() {
 			for cdep := range fetch {
 				rev, err := FetchDep(cdl.Resolver, cdep, cdl.Update)
+				// Updated branches are expected to differ from the lock
+				if err == nil && !(cdl.Update && cdep.Branch != "") {
+					err = VerifyHash(cdl.Gopath, cdep)
+				}
 				results <- update{cdep, rev, err}
 			}
 			wg.Done()
@@ -96,21 +316,27 @@ func (cdl *CanticleDepLoader) Updated() map[string]string {
 }
 
 // FetchDep fetchs a single canticle dep using the resolver. If update
-// is true it will update the vcs branch to cdep.Revision. If not
-// updated the rev string will be the empty string.
+// is true and the dep is locked from a branch it will check out and
+// update that branch instead of the locked revision, otherwise it
+// will update the vcs branch to cdep.Revision. If not updated the rev
+// string will be the empty string.
 func FetchDep(resolver RepoResolver, cdep *CanticleDependency, update bool) (string, error) {
 	LogInfo("Resolving repo for cdep %+v", cdep)
 	vcs, err := resolver.ResolveRepo(cdep.Root, cdep)
 	if err != nil {
 		return "", fmt.Errorf("cant create vcs for %v because %s", cdep, err.Error())
 	}
+	rev := cdep.Revision
+	if update && cdep.Branch != "" {
+		rev = cdep.Branch
+	}
 	LogInfo("Fetching cdep %+v", cdep)
-	if err := vcs.Create(cdep.Revision); err != nil {
+	if err := vcs.Create(rev); err != nil {
 		return "", fmt.Errorf("cant fetch repo %s because %s", cdep.Root, err.Error())
 	}
 	if update {
 		LogVerbose("Updating cdep %+v", cdep)
-		updated, res, err := vcs.UpdateBranch(cdep.Revision)
+		updated, res, err := vcs.UpdateBranch(rev)
 		if !updated {
 			res = ""
 		}
@@ -2,6 +2,8 @@ package canticles
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
 	"sync"
 	"testing"
 )
@@ -156,3 +158,111 @@ func checkResolutions(t *testing.T, test test, dep *CanticleDependency) {
 	}
 
 }
+
+type testPkgDepReader map[string][]*CanticleDependency
+
+func (dr testPkgDepReader) CanticleDependencies(pkg string) ([]*CanticleDependency, error) {
+	deps, ok := dr[pkg]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return deps, nil
+}
+
+func TestCantDepLoaderRecursive(t *testing.T) {
+	reader := testPkgDepReader{
+		testPkg: {
+			{Root: "a", Revision: "a1"},
+			{Root: "b", Revision: "b1"},
+		},
+		"a": {
+			{Root: "b", Revision: "b2"},
+			{Root: "c", Revision: "c1"},
+			{Root: "d", Revision: "d1"},
+			{Root: "e", Revision: "e1", Scope: ScopeTest},
+		},
+		"b": {{Root: "c", Revision: "c2"}},
+		"c": {{Root: "d", Revision: "d2"}},
+	}
+	vcs := make(map[string]resolution)
+	for _, root := range []string{"a", "b", "c", "d", "e"} {
+		vcs[root] = resolution{&TestVCS{}, nil}
+	}
+	resolver := newTestRepoRes(vcs)
+	ar := &AuthoritativeResolution{Deps: []*CanticleDependency{{Root: "c", Revision: "c2"}, {Root: "d", Revision: "d2"}}}
+	loader := &CanticleDepLoader{
+		Reader:    reader,
+		Resolver:  resolver,
+		Gopath:    "/home/rfliam/go",
+		Recursive: true,
+		Conflicts: ar,
+		Limit:     2,
+	}
+	if errs := loader.FetchPath(testPath); len(errs) > 0 {
+		t.Fatalf("Recursive fetch returned errors %v", errs)
+	}
+	expected := map[string]string{"a": "a1", "b": "b1", "c": "c2", "d": "d2"}
+	for root, rev := range expected {
+		if v := vcs[root].vcs; v.Rev != rev {
+			t.Errorf("Expected %s fetched at %s got %s", root, rev, v.Rev)
+		}
+	}
+	if resolver.calls["e"] {
+		t.Errorf("Fetched test dep e of a")
+	}
+
+	loader.Conflicts = &FailResolution{}
+	if errs := loader.FetchPath(testPath); len(errs) != 1 {
+		t.Errorf("Expected conflict error with FailResolution got %v", errs)
+	}
+}
+
+func TestCantDepLoaderImports(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-imports")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	// a is on disk as if fetched, x and y are only imported
+	for _, pkg := range []string{testPkg, "a"} {
+		if err := os.MkdirAll(PackageSource(gopath, pkg), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imports := &TestDependencyReader{map[string]TestDependencyRead{
+		PackageSource(gopath, testPkg): {NewDependencies(), nil},
+		PackageSource(gopath, "a"):     {NewDependencies(), nil},
+		PackageSource(gopath, "x"):     {NewDependencies(), nil},
+		PackageSource(gopath, "y"):     {NewDependencies(), nil},
+	}}
+	imports.PackageDeps[PackageSource(gopath, testPkg)].Deps.AddDeps("a", "x")
+	imports.PackageDeps[PackageSource(gopath, "a")].Deps.AddDeps("y")
+	vcs := map[string]*TestVCS{"a": {Root: "a"}, "x": {Root: "x"}, "y": {Root: "y"}}
+	resolver := &TestResolver{map[string]*TestVCSResolve{}}
+	for root, v := range vcs {
+		resolver.ResolvePaths[root] = &TestVCSResolve{v, nil}
+	}
+	loader := &CanticleDepLoader{
+		Reader:    testPkgDepReader{testPkg: {{Root: "a", Revision: "a1"}}},
+		Resolver:  resolver,
+		Gopath:    gopath,
+		Recursive: true,
+		Imports:   imports.ReadDependencies,
+	}
+	if errs := loader.FetchPath(PackageSource(gopath, testPkg)); len(errs) > 0 {
+		t.Fatalf("Recursive fetch returned errors %v", errs)
+	}
+	if v := vcs["a"]; v.Created != 1 || v.Rev != "a1" {
+		t.Errorf("Expected a fetched once at a1 got %d at %s", v.Created, v.Rev)
+	}
+	for _, root := range []string{"x", "y"} {
+		if v := vcs[root]; v.Created != 1 || v.Rev != "" {
+			t.Errorf("Expected import %s fetched once at its default got %d at %s", root, v.Created, v.Rev)
+		}
+	}
+
+	resolver.ResolvePaths["y"].Err = errors.New("no y")
+	if errs := loader.FetchPath(PackageSource(gopath, testPkg)); len(errs) != 1 {
+		t.Errorf("Expected an error fetching import y got %v", errs)
+	}
+}
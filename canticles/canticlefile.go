@@ -0,0 +1,138 @@
+package canticles
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode"
+)
+
+// Canticle file format versions. LegacyFormatVersion files are a bare
+// JSON array of CanticleDependencies. Later versions are a
+// CanticleFile object.
+const (
+	LegacyFormatVersion   = 1
+	CanticleFormatVersion = 2
+)
+
+// A CanticleFile is the content of a Canticle file.
+type CanticleFile struct {
+	// Version of the file format, files with a version newer than
+	// CanticleFormatVersion are refused.
+	Version int
+	// Package the file was saved for.
+	Package string `json:",omitempty"`
+	// Deps are the dependencies of the package.
+	Deps []*CanticleDependency
+}
+
+// NewCanticleFile returns a CanticleFile of the current format
+// version.
+func NewCanticleFile(pkg string, deps []*CanticleDependency) *CanticleFile {
+	return &CanticleFile{Version: CanticleFormatVersion, Package: pkg, Deps: deps}
+}
+
+// A FormatVersionError is returned when reading a Canticle file
+// written in a newer format than this cant understands.
+type FormatVersionError struct {
+	Version int
+}
+
+func (fe *FormatVersionError) Error() string {
+	return fmt.Sprintf("Canticle file format version %d is newer than supported version %d, upgrade cant", fe.Version, CanticleFormatVersion)
+}
+
+// ReadCanticleFile decodes a Canticle file of any supported format
+// from r. Legacy arrays are returned with LegacyFormatVersion.
+func ReadCanticleFile(r io.Reader) (*CanticleFile, error) {
+	br := bufio.NewReader(r)
+	first, err := firstNonSpace(br)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(br)
+	if first == '[' {
+		cf := &CanticleFile{Version: LegacyFormatVersion}
+		if err := d.Decode(&cf.Deps); err != nil {
+			return nil, err
+		}
+		return cf, nil
+	}
+	cf := &CanticleFile{}
+	if err := d.Decode(cf); err != nil {
+		return nil, err
+	}
+	switch {
+	case cf.Version > CanticleFormatVersion:
+		return nil, &FormatVersionError{cf.Version}
+	case cf.Version <= LegacyFormatVersion:
+		return nil, fmt.Errorf("Canticle file has invalid format version %d", cf.Version)
+	}
+	return cf, nil
+}
+
+// firstNonSpace returns the first non whitespace rune of br without
+// consuming it.
+func firstNonSpace(br *bufio.Reader) (rune, error) {
+	for {
+		r, _, err := br.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(r) {
+			return r, br.UnreadRune()
+		}
+	}
+}
+
+// LoadCanticleFile reads the Canticle file at path. If the file does
+// not exist the error satisfies os.IsNotExist.
+func LoadCanticleFile(path string) (*CanticleFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	LogVerbose("Reading canticle file: %s", f.Name())
+	cf, err := ReadCanticleFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("cant read Canticle file %s %s", path, err.Error())
+	}
+	// Signature keys are relative to the file
+	for _, cdep := range cf.Deps {
+		if cdep.Signature != nil {
+			cdep.Signature.dir = filepath.Dir(path)
+		}
+	}
+	return cf, nil
+}
+
+// Marshal returns the file in the current format with its deps
+// sorted by root.
+func (cf *CanticleFile) Marshal() ([]byte, error) {
+	out := *cf
+	out.Version = CanticleFormatVersion
+	if out.Deps == nil {
+		out.Deps = []*CanticleDependency{}
+	}
+	sort.Sort(CanticleDependencies(out.Deps))
+	b, err := json.MarshalIndent(&out, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// WriteCanticleFile writes cf to path in the current format.
+func WriteCanticleFile(path string, cf *CanticleFile) error {
+	b, err := cf.Marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,44 @@
+package canticles
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCanticleFile(t *testing.T) {
+	legacy := `
+	[{"Root": "test.com/a", "Revision": "abc"}]`
+	cf, err := ReadCanticleFile(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatalf("ReadCanticleFile returned error for legacy file: %s", err.Error())
+	}
+	expected := []*CanticleDependency{{Root: "test.com/a", Revision: "abc"}}
+	if cf.Version != LegacyFormatVersion || !reflect.DeepEqual(expected, cf.Deps) {
+		t.Errorf("ReadCanticleFile legacy file returned %+v", cf)
+	}
+
+	b, err := NewCanticleFile("test.com/pkg", expected).Marshal()
+	if err != nil {
+		t.Fatalf("CanticleFile error marshaling: %s", err.Error())
+	}
+	cf, err = ReadCanticleFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadCanticleFile returned error for current file: %s", err.Error())
+	}
+	if cf.Version != CanticleFormatVersion || cf.Package != "test.com/pkg" || !reflect.DeepEqual(expected, cf.Deps) {
+		t.Errorf("ReadCanticleFile current file returned %+v", cf)
+	}
+
+	_, err = ReadCanticleFile(strings.NewReader(`{"Version": 99, "Deps": []}`))
+	if _, ok := err.(*FormatVersionError); !ok {
+		t.Errorf("ReadCanticleFile expected FormatVersionError for newer file got %v", err)
+	}
+	if _, err := ReadCanticleFile(strings.NewReader(`{"Deps": []}`)); err == nil {
+		t.Errorf("ReadCanticleFile returned no error for object without version")
+	}
+	if _, err := ReadCanticleFile(strings.NewReader("")); err == nil {
+		t.Errorf("ReadCanticleFile returned no error for empty file")
+	}
+}
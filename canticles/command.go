@@ -33,6 +33,13 @@ var Commands = map[string]*Command{
 	"save":       SaveCommand,
 	"vendor":     VendorCommand,
 	"genversion": GenVersionCommand,
+	"resolve":    ResolveCommand,
+	"tools":      ToolsCommand,
+	"migrate":    MigrateCommand,
+	"update":     UpdateCommand,
+	"verify":     VerifyCommand,
+	"conflicts":  ConflictsCommand,
+	"prune":      PruneCommand,
 }
 
 // Usage will print the commands UsageLine and LongDescription and
@@ -1,6 +1,14 @@
 package canticles
 
-import "fmt"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
 
 type ConflictResolver interface {
 	ResolveConflicts(deps *DependencySources) ([]*CanticleDependency, error)
@@ -25,15 +33,32 @@ func (pl *PreferLocalResolution) ResolveConflicts(deps *DependencySources) ([]*C
 	return cdeps, nil
 }
 
+// PromptResolution asks the user to choose between conflicting
+// revisions and sources. Each choice shows the Canticle files that
+// wanted it and, if Gopath is set, how far each revision is from the
+// revision on disk.
 type PromptResolution struct {
 	Printf func(format string, a ...interface{}) (n int, err error)
 	Scanf  func(format string, a ...interface{}) (n int, err error)
+	Gopath string
 }
 
+// ErrorSkipConflict is returned by ResolvePrompt when the user skips
+// a dependency, it is left out of the resolved dependencies.
+var ErrorSkipConflict = errors.New("skip this conflict")
+
+// ErrorAbortConflict is returned by ResolvePrompt when the user
+// aborts resolution.
+var ErrorAbortConflict = errors.New("cant resolve conflicts, aborted")
+
 func (pr PromptResolution) ResolveConflicts(deps *DependencySources) ([]*CanticleDependency, error) {
 	cdeps := make([]*CanticleDependency, 0, len(deps.Sources))
 	for _, dep := range deps.Sources {
 		cd, err := pr.ResolveConflict(dep)
+		if err == ErrorSkipConflict {
+			LogWarn("Skipping %s, it will not be saved", dep.Root)
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -43,51 +68,329 @@ func (pr PromptResolution) ResolveConflicts(deps *DependencySources) ([]*Canticl
 }
 
 func (pr PromptResolution) ResolveConflict(dep *DependencySource) (*CanticleDependency, error) {
-	cd := &CanticleDependency{Root: dep.Root}
+	cd := resolveWanted(dep)
 	var err error
-	size := dep.Revisions.Size()
-	switch {
-	case size > 1:
+	// Compatible version constraints are not a conflict
+	if len(dep.ConflictingRevisions()) > 1 {
 		cd.Revision, err = pr.SelectRevision(dep)
 		if err != nil {
 			return cd, err
 		}
-	case size == 1:
-		cd.Revision = dep.Revisions.Array()[0]
 	}
-	size = dep.Sources.Size()
-	switch {
-	case size > 1:
+	if len(dep.ConflictingSources()) > 1 {
 		cd.SourcePath, err = pr.SelectSource(dep)
-	case size == 1:
-		cd.SourcePath = dep.Sources.Array()[0]
 	}
 	return cd, err
 }
 
 func (pr PromptResolution) SelectRevision(dep *DependencySource) (string, error) {
-	return pr.ResolvePrompt(dep.Root, "revisions", dep.OnDiskRevision, dep.Revisions.Array())
+	var lv *LocalVCS
+	if pr.Gopath != "" {
+		resolver := &LocalRepoResolver{LocalPath: pr.Gopath}
+		if v, err := resolver.ResolveRepo(dep.Root, nil); err == nil {
+			lv, _ = v.(*LocalVCS)
+		}
+	}
+	ondisk := dep.OnDiskCommit
+	if ondisk == "" {
+		ondisk = dep.OnDiskRevision
+	}
+	describe := func(rev string) []string {
+		var notes []string
+		switch {
+		case rev == dep.OnDiskRevision:
+			notes = append(notes, "on disk")
+		case lv != nil && ondisk != "":
+			if ahead, behind, err := lv.Distance(ondisk, rev); err == nil {
+				notes = append(notes, fmt.Sprintf("%d ahead, %d behind on disk", ahead, behind))
+			}
+		}
+		return append(notes, wantedBy(dep.RevisionsFrom[rev])...)
+	}
+	return pr.ResolvePrompt(dep.Root, "revisions", dep.ConflictingRevisions(), describe)
 }
 
 func (pr PromptResolution) SelectSource(dep *DependencySource) (string, error) {
-	return pr.ResolvePrompt(dep.Root, "sources", dep.OnDiskSource, dep.Sources.Array())
+	describe := func(source string) []string {
+		var notes []string
+		if source == dep.OnDiskSource {
+			notes = append(notes, "on disk")
+		}
+		return append(notes, wantedBy(dep.SourcesFrom[source])...)
+	}
+	return pr.ResolvePrompt(dep.Root, "sources", dep.ConflictingSources(), describe)
+}
+
+func wantedBy(paths StringSet) []string {
+	if paths.Size() == 0 {
+		return nil
+	}
+	return []string{"wanted by " + strings.Join(paths.Array(), ", ")}
 }
 
 // ResolvePrompt is used to prompt a user for a resolution between
-// multiple alternates, wth ondisk marking the currently select
-// option.
+// multiple numbered alternates, with describe returning notes to show
+// for each. The user may enter a number or an alternate, s or skip
+// to return ErrorSkipConflict, or a or abort to return
+// ErrorAbortConflict. Anything else is prompted for again.
 // TODO: Add some sort of auto completion here
-func (pr PromptResolution) ResolvePrompt(pkg, conflict, ondisk string, alts []string) (string, error) {
+func (pr PromptResolution) ResolvePrompt(pkg, conflict string, alts []string, describe func(alt string) []string) (string, error) {
 	pr.Printf("\nPackage %s has conflicting %s:\n", pkg, conflict)
-	for _, rev := range alts {
-		if rev == ondisk {
-			pr.Printf("%s %s\n", rev, "(current)")
+	for i, alt := range alts {
+		pr.Printf("  %d) %s\n", i+1, alt)
+		for _, note := range describe(alt) {
+			pr.Printf("       %s\n", note)
+		}
+	}
+	pr.Printf("  s) skip, do not save %s\n", pkg)
+	pr.Printf("  a) abort\n")
+	for {
+		pr.Printf("Selection %s [1-%d, s, a]: ", conflict, len(alts))
+		var choice string
+		_, err := pr.Scanf("%s\n", &choice)
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return "", ErrorAbortConflict
+		case err != nil:
+			pr.Printf("Invalid selection, enter one choice.\n")
 			continue
 		}
-		pr.Printf("%s\n", rev)
+		if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(alts) {
+			return alts[n-1], nil
+		}
+		for _, alt := range alts {
+			if choice == alt {
+				return alt, nil
+			}
+		}
+		switch choice {
+		case "s", "skip":
+			return "", ErrorSkipConflict
+		case "a", "abort":
+			return "", ErrorAbortConflict
+		}
+		pr.Printf("Invalid selection %q.\n", choice)
+	}
+}
+
+// NewConflictResolver returns the ConflictResolver named by spec, one
+// of prompt, ondisk, newest, fail or authority=<Canticle file>.
+func NewConflictResolver(spec, gopath string) (ConflictResolver, error) {
+	name, arg := spec, ""
+	if i := strings.Index(spec, "="); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	switch {
+	case name == "prompt":
+		return &PromptResolution{Printf: fmt.Printf, Scanf: fmt.Scanf, Gopath: gopath}, nil
+	case name == "ondisk":
+		return &PreferLocalResolution{}, nil
+	case name == "newest":
+		return &NewestResolution{Gopath: gopath}, nil
+	case name == "fail":
+		return &FailResolution{}, nil
+	case name == "authority" && arg != "":
+		return NewAuthoritativeResolution(arg)
+	}
+	return nil, fmt.Errorf("unknown conflict resolution %q, use prompt, ondisk, newest, fail or authority=<Canticle file>", spec)
+}
+
+// A ConflictError reports every dependency with conflicting
+// revisions or sources.
+type ConflictError struct {
+	Conflicts []*DependencySource
+}
+
+func (ce *ConflictError) Error() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "cant resolve %d conflicting dependencies:\n", len(ce.Conflicts))
+	for _, source := range ce.Conflicts {
+		b.WriteString(ConflictReport(source))
+	}
+	return b.String()
+}
+
+// ConflictReport describes the conflicting revisions and sources of
+// source, which is on disk and the Canticle files wanting each.
+func ConflictReport(source *DependencySource) string {
+	return source.Root + "\n" +
+		reportWanted("revisions", source.ConflictingRevisions(), source.OnDiskRevision, source.RevisionsFrom) +
+		reportWanted("sources", source.ConflictingSources(), source.OnDiskSource, source.SourcesFrom)
+}
+
+func reportWanted(kind string, wanted []string, ondisk string, from map[string]StringSet) string {
+	if len(wanted) < 2 {
+		return ""
+	}
+	report := fmt.Sprintf("\t%s:\n", kind)
+	for _, w := range wanted {
+		report += "\t\t" + w
+		if w == ondisk {
+			report += " (on disk)"
+		}
+		if paths := from[w]; paths.Size() > 0 {
+			report += " wanted by " + strings.Join(paths.Array(), ", ")
+		}
+		report += "\n"
+	}
+	return report
+}
+
+// resolveUnconflicted returns the dependency for source if it wants
+// at most one revision and source, otherwise nil.
+func resolveUnconflicted(source *DependencySource) *CanticleDependency {
+	if source.Conflicted() {
+		return nil
 	}
-	pr.Printf("Selection %s: ", conflict)
-	var choice string
-	_, err := pr.Scanf("%s", &choice)
-	return choice, err
+	return resolveWanted(source)
+}
+
+// resolveWanted returns the dependency for source with the revision
+// and source wanted if only one is, otherwise those on disk.
+func resolveWanted(source *DependencySource) *CanticleDependency {
+	cd := &CanticleDependency{
+		Root:       source.Root,
+		SourcePath: source.OnDiskSource,
+		Revision:   source.OnDiskRevision,
+	}
+	if revs := source.ConflictingRevisions(); len(revs) == 1 {
+		cd.Revision = revs[0]
+	}
+	if sources := source.ConflictingSources(); len(sources) == 1 {
+		cd.SourcePath = sources[0]
+	}
+	return cd
+}
+
+// FailResolution resolves dependencies without conflicts and returns
+// a ConflictError reporting all conflicts if there are any.
+type FailResolution struct {
+}
+
+func (fr *FailResolution) ResolveConflicts(deps *DependencySources) ([]*CanticleDependency, error) {
+	cdeps := make([]*CanticleDependency, 0, len(deps.Sources))
+	var conflicts []*DependencySource
+	for _, source := range deps.Sources {
+		if source.Err != nil {
+			return nil, fmt.Errorf("cant resolve error saving dep %s", source.Err.Error())
+		}
+		cd := resolveUnconflicted(source)
+		if cd == nil {
+			conflicts = append(conflicts, source)
+			continue
+		}
+		cdeps = append(cdeps, cd)
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{conflicts}
+	}
+	return cdeps, nil
+}
+
+// NewestResolution resolves conflicting revisions to the newest, by
+// ancestry or else commit date, in the repo of each dependency in
+// Gopath. Conflicting sources resolve to the source on disk.
+type NewestResolution struct {
+	Gopath string
+}
+
+func (nr *NewestResolution) ResolveConflicts(deps *DependencySources) ([]*CanticleDependency, error) {
+	resolver := &LocalRepoResolver{LocalPath: nr.Gopath}
+	cdeps := make([]*CanticleDependency, 0, len(deps.Sources))
+	for _, source := range deps.Sources {
+		if source.Err != nil {
+			return nil, fmt.Errorf("cant resolve error saving dep %s", source.Err.Error())
+		}
+		cd := resolveWanted(source)
+		if revs := source.ConflictingRevisions(); len(revs) > 1 {
+			v, err := resolver.ResolveRepo(source.Root, nil)
+			lv, ok := v.(*LocalVCS)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("cant compare revisions of %s without its repo on disk", source.Root)
+			}
+			cd.Revision = revs[0]
+			for _, rev := range revs[1:] {
+				if cd.Revision, err = lv.Newer(cd.Revision, rev); err != nil {
+					return nil, fmt.Errorf("cant find newest revision of %s %s", source.Root, err.Error())
+				}
+			}
+			LogInfo("Resolved %s to newest revision %s of %v", source.Root, cd.Revision, revs)
+		}
+		if len(source.ConflictingSources()) > 1 {
+			if !source.Sources[source.OnDiskSource] {
+				return nil, &ConflictError{[]*DependencySource{source}}
+			}
+			cd.SourcePath = source.OnDiskSource
+		}
+		cdeps = append(cdeps, cd)
+	}
+	return cdeps, nil
+}
+
+// AuthoritativeResolution resolves conflicts with the revisions and
+// sources in an authoritative Canticle file. Conflicts over
+// dependencies the file does not pin fail as with FailResolution.
+type AuthoritativeResolution struct {
+	Path string
+	Deps []*CanticleDependency
+}
+
+// NewAuthoritativeResolution reads the Canticle file at path. If path
+// is a directory its Canticle.lock is preferred, falling back to its
+// Canticle file.
+func NewAuthoritativeResolution(path string) (*AuthoritativeResolution, error) {
+	if s, err := os.Stat(path); err == nil && s.IsDir() {
+		if _, err := os.Stat(LockFile(path)); err == nil {
+			path = LockFile(path)
+		} else {
+			path = DependencyFile(path)
+		}
+	}
+	cf, err := LoadCanticleFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cant read authoritative Canticle file %s", err.Error())
+	}
+	return &AuthoritativeResolution{Path: path, Deps: cf.Deps}, nil
+}
+
+func (ar *AuthoritativeResolution) ResolveConflicts(deps *DependencySources) ([]*CanticleDependency, error) {
+	cdeps := make([]*CanticleDependency, 0, len(deps.Sources))
+	var conflicts []*DependencySource
+	for _, source := range deps.Sources {
+		if source.Err != nil {
+			return nil, fmt.Errorf("cant resolve error saving dep %s", source.Err.Error())
+		}
+		cd := resolveUnconflicted(source)
+		var pinned *CanticleDependency
+		for _, dep := range ar.Deps {
+			if dep.Root == source.Root {
+				pinned = dep
+			}
+		}
+		switch {
+		case pinned == nil && cd == nil:
+			conflicts = append(conflicts, source)
+			continue
+		case pinned == nil:
+		case pinned.Revision == "" && len(source.ConflictingRevisions()) > 1,
+			pinned.SourcePath == "" && len(source.ConflictingSources()) > 1:
+			LogWarn("Authoritative Canticle file %s does not pin every conflict of %s", ar.Path, source.Root)
+			conflicts = append(conflicts, source)
+			continue
+		default:
+			cd = resolveWanted(source)
+			if pinned.Revision != "" {
+				cd.Revision = pinned.Revision
+			}
+			if pinned.SourcePath != "" {
+				cd.SourcePath = pinned.SourcePath
+			}
+			LogVerbose("Resolved %s from %s to %s", source.Root, ar.Path, cd.Revision)
+		}
+		cdeps = append(cdeps, cd)
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{conflicts}
+	}
+	return cdeps, nil
 }
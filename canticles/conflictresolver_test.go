@@ -0,0 +1,175 @@
+package canticles
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+func testConflictSources() *DependencySources {
+	sources := NewDependencySources(2)
+	conflicted := NewDependencySource("test.com/a")
+	conflicted.Revisions.Add("abc")
+	conflicted.OnDiskRevision = "abc"
+	conflicted.AddCantSource(&CanticleDependency{Root: "test.com/a", Revision: "def"}, "test.com/b")
+	sources.AddSource(conflicted)
+	single := NewDependencySource("test.com/c")
+	single.Revisions.Add("123")
+	single.OnDiskRevision = "123"
+	sources.AddSource(single)
+	return sources
+}
+
+// testPrompt returns a PromptResolution answering with inputs and
+// printing to out.
+func testPrompt(out *bytes.Buffer, inputs ...string) PromptResolution {
+	return PromptResolution{
+		Printf: func(format string, a ...interface{}) (int, error) {
+			return fmt.Fprintf(out, format, a...)
+		},
+		Scanf: func(format string, a ...interface{}) (int, error) {
+			if len(inputs) == 0 {
+				return 0, io.EOF
+			}
+			*a[0].(*string) = inputs[0]
+			inputs = inputs[1:]
+			return 1, nil
+		},
+	}
+}
+
+func TestPromptResolution(t *testing.T) {
+	var out bytes.Buffer
+	cdeps, err := testPrompt(&out, "9", "typo", "2").ResolveConflicts(testConflictSources())
+	if err != nil {
+		t.Fatalf("PromptResolution returned error %s", err.Error())
+	}
+	if len(cdeps) != 2 || cdeps[0].Revision != "def" || cdeps[1].Revision != "123" {
+		t.Errorf("PromptResolution returned %+v %+v", cdeps[0], cdeps[1])
+	}
+	prompt := out.String()
+	for _, expected := range []string{"1) abc", "on disk", "2) def", "wanted by test.com/b", "s) skip", `Invalid selection "typo"`} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("PromptResolution prompt missing %q:\n%s", expected, prompt)
+		}
+	}
+
+	cdeps, err = testPrompt(&out, "def").ResolveConflicts(testConflictSources())
+	if err != nil || len(cdeps) != 2 || cdeps[0].Revision != "def" {
+		t.Errorf("PromptResolution did not accept a revision as the choice %v %v", cdeps, err)
+	}
+	cdeps, err = testPrompt(&out, "s").ResolveConflicts(testConflictSources())
+	if err != nil || len(cdeps) != 1 || cdeps[0].Root != "test.com/c" {
+		t.Errorf("PromptResolution did not skip the conflict %v %v", cdeps, err)
+	}
+	for _, inputs := range [][]string{{"a"}, {"abort"}, {}} {
+		if _, err := testPrompt(&out, inputs...).ResolveConflicts(testConflictSources()); err != ErrorAbortConflict {
+			t.Errorf("PromptResolution with input %v expected abort got %v", inputs, err)
+		}
+	}
+}
+
+func TestFailResolution(t *testing.T) {
+	_, err := (&FailResolution{}).ResolveConflicts(testConflictSources())
+	ce, ok := err.(*ConflictError)
+	if !ok || len(ce.Conflicts) != 1 || ce.Conflicts[0].Root != "test.com/a" {
+		t.Fatalf("FailResolution expected one conflict got %v", err)
+	}
+	report := ce.Error()
+	for _, expected := range []string{"test.com/a", "abc (on disk)", "def wanted by test.com/b"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("ConflictError report missing %q:\n%s", expected, report)
+		}
+	}
+
+	sources := testConflictSources()
+	sources.Sources = sources.Sources[1:]
+	cdeps, err := (&FailResolution{}).ResolveConflicts(sources)
+	if err != nil || len(cdeps) != 1 || cdeps[0].Revision != "123" {
+		t.Errorf("FailResolution without conflicts returned %v %v", cdeps, err)
+	}
+}
+
+func TestAuthoritativeResolution(t *testing.T) {
+	ar := &AuthoritativeResolution{Path: "Canticle", Deps: []*CanticleDependency{{Root: "test.com/a", Revision: "def"}}}
+	cdeps, err := ar.ResolveConflicts(testConflictSources())
+	if err != nil {
+		t.Fatalf("AuthoritativeResolution returned error %s", err.Error())
+	}
+	if len(cdeps) != 2 || cdeps[0].Revision != "def" || cdeps[1].Revision != "123" {
+		t.Errorf("AuthoritativeResolution returned %+v %+v", cdeps[0], cdeps[1])
+	}
+	ar.Deps = []*CanticleDependency{{Root: "test.com/c", Revision: "456"}}
+	if _, err := ar.ResolveConflicts(testConflictSources()); err == nil {
+		t.Errorf("AuthoritativeResolution returned no error for unpinned conflict")
+	}
+}
+
+func TestNewAuthoritativeResolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cant-test-authority")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	write := func(file, rev string) {
+		cdeps := []*CanticleDependency{{Root: "test.com/a", Revision: rev}}
+		if err := WriteCanticleFile(file, NewCanticleFile("test.com/app", cdeps)); err != nil {
+			t.Fatalf("Error writing %s: %s", file, err.Error())
+		}
+	}
+	check := func(path, rev string) {
+		ar, err := NewAuthoritativeResolution(path)
+		if err != nil {
+			t.Fatalf("NewAuthoritativeResolution(%s) returned error %s", path, err.Error())
+		}
+		if len(ar.Deps) != 1 || ar.Deps[0].Revision != rev {
+			t.Errorf("NewAuthoritativeResolution(%s) expected %s got %+v", path, rev, ar.Deps)
+		}
+	}
+	if _, err := NewAuthoritativeResolution(dir); err == nil {
+		t.Errorf("NewAuthoritativeResolution returned no error for a directory without Canticle files")
+	}
+	write(DependencyFile(dir), "master")
+	check(dir, "master")
+	write(LockFile(dir), "abc")
+	check(dir, "abc")
+	check(DependencyFile(dir), "master")
+}
+
+func TestNewer(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-newer")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	tr := newTestGitRepo(t, gopath, "test.com/a")
+	commit := func(file, date string) string {
+		tr.env = []string{"GIT_COMMITTER_DATE=" + date, "GIT_AUTHOR_DATE=" + date}
+		return tr.commit(file, file)
+	}
+	base := commit("a", "2020-01-01T00:00:00Z")
+	// A child with an older date is still newer by ancestry
+	child := commit("b", "2019-01-01T00:00:00Z")
+	tr.git("checkout", "-q", "-b", "other", base)
+	late := commit("c", "2021-01-01T00:00:00Z")
+
+	lv := NewLocalVCS("test.com/a", "test.com/a", gopath, vcs.ByCmd("git"))
+	cases := [][3]string{
+		{base, child, child},
+		{child, base, child},
+		{child, late, late},
+		{late, child, late},
+	}
+	for _, c := range cases {
+		newer, err := lv.Newer(c[0], c[1])
+		if err != nil || newer != c[2] {
+			t.Errorf("Newer(%s, %s) expected %s got %s %v", c[0], c[1], c[2], newer, err)
+		}
+	}
+}
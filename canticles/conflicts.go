@@ -0,0 +1,163 @@
+package canticles
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+type Conflicts struct {
+	flags     *flag.FlagSet
+	Verbose   bool
+	JSON      bool
+	Branches  bool
+	NoSources bool
+	Excludes  DirFlags
+	Platforms BuildContexts
+	Resolvers ResolverFlags
+}
+
+func NewConflicts() *Conflicts {
+	f := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	c := &Conflicts{flags: f, Excludes: DirFlags(NewStringSet())}
+	f.BoolVar(&c.Verbose, "v", false, "Be verbose when reading deps.")
+	f.BoolVar(&c.JSON, "json", false, "Print the conflicts as JSON.")
+	f.BoolVar(&c.Branches, "b", false, "Compare the branches on disk, not revisions.")
+	f.BoolVar(&c.NoSources, "no-sources", false, "Don't report conflicting sources.")
+	f.Var(&c.Excludes, "exclude", "Do not recur into these directories unless they are in the dep tree.")
+	f.Var(&c.Platforms, "platform", "Read imports under this goos/goarch[:tags], may be repeated.")
+	c.Resolvers.Register(f, "local")
+	return c
+}
+
+var conflicts = NewConflicts()
+
+var ConflictsCommand = &Command{
+	Name:             "conflicts",
+	UsageLine:        "conflicts [-v] [-json] [-b] [-no-sources] [-exclude <dir>] [-platform <goos/goarch[:tags]>] [-resolvers <list>]",
+	ShortDescription: "Report conflicting revisions and sources without saving.",
+	LongDescription: `The conflicts command reads the dependencies of the current project, and the Canticle files of those dependencies, as save does and reports every dependency for which more than one revision or source is wanted. Each is listed with the revision and source on disk and the Canticle files wanting each alternative. Nothing is saved. The command exits non zero if there are conflicts, so it may be run in CI or code review.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -json to print the conflicts as a JSON array.
+
+Specify -b, -no-sources, -exclude, -platform and -resolvers as with save.`,
+	Flags: conflicts.flags,
+	Cmd:   conflicts,
+}
+
+// A DependencyConflict is the JSON report of a conflicting
+// DependencySource. Revisions and Sources map each alternative to
+// the Canticle files wanting it and are only set if they conflict.
+type DependencyConflict struct {
+	Root           string
+	OnDiskRevision string              `json:",omitempty"`
+	OnDiskSource   string              `json:",omitempty"`
+	Revisions      map[string][]string `json:",omitempty"`
+	Sources        map[string][]string `json:",omitempty"`
+}
+
+// NewDependencyConflict returns the report for source.
+func NewDependencyConflict(source *DependencySource) *DependencyConflict {
+	dc := &DependencyConflict{
+		Root:           source.Root,
+		OnDiskRevision: source.OnDiskRevision,
+		OnDiskSource:   source.OnDiskSource,
+	}
+	dc.Revisions = conflictFrom(source.ConflictingRevisions(), source.RevisionsFrom)
+	dc.Sources = conflictFrom(source.ConflictingSources(), source.SourcesFrom)
+	return dc
+}
+
+func conflictFrom(wanted []string, from map[string]StringSet) map[string][]string {
+	if len(wanted) < 2 {
+		return nil
+	}
+	result := make(map[string][]string, len(wanted))
+	for _, w := range wanted {
+		result[w] = []string{}
+		if paths := from[w]; paths != nil {
+			result[w] = paths.Array()
+		}
+	}
+	return result
+}
+
+// Run the conflicts command.
+func (c *Conflicts) Run(args []string) {
+	if c.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gopath, err := EnvGoPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	found, err := c.FindConflicts(gopath, wd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.Report(os.Stdout, found); err != nil {
+		log.Fatal(err)
+	}
+	if len(found) > 0 {
+		os.Exit(1)
+	}
+}
+
+// FindConflicts reads the deps and sources of path, as save would,
+// and returns those which conflict.
+func (c *Conflicts) FindConflicts(gopath, path string) ([]*DependencySource, error) {
+	s := &Save{
+		Branches:  c.Branches,
+		NoSources: c.NoSources,
+		Excludes:  c.Excludes,
+		Platforms: c.Platforms,
+		Resolvers: c.Resolvers,
+	}
+	deps, err := s.ReadDeps(gopath, path)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := s.GetSources(gopath, path, deps)
+	if err != nil {
+		return nil, err
+	}
+	return sources.Conflicts(), nil
+}
+
+// Report prints found to w as text or JSON.
+func (c *Conflicts) Report(w io.Writer, found []*DependencySource) error {
+	if c.JSON {
+		report := make([]*DependencyConflict, 0, len(found))
+		for _, source := range found {
+			report = append(report, NewDependencyConflict(source))
+		}
+		b, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+	if len(found) == 0 {
+		_, err := fmt.Fprintln(w, "No conflicts")
+		return err
+	}
+	fmt.Fprintf(w, "%d conflicting dependencies:\n", len(found))
+	for _, source := range found {
+		if _, err := fmt.Fprint(w, ConflictReport(source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
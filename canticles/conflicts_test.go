@@ -0,0 +1,105 @@
+package canticles
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNewDependencyConflict(t *testing.T) {
+	found := testConflictSources().Conflicts()
+	if len(found) != 1 {
+		t.Fatalf("Expected one conflict got %d", len(found))
+	}
+	dc := NewDependencyConflict(found[0])
+	expected := &DependencyConflict{
+		Root:           "test.com/a",
+		OnDiskRevision: "abc",
+		Revisions:      map[string][]string{"abc": {}, "def": {"test.com/b"}},
+	}
+	if !reflect.DeepEqual(dc, expected) {
+		t.Errorf("NewDependencyConflict expected %+v got %+v", expected, dc)
+	}
+	if from := conflictFrom([]string{"abc"}, nil); from != nil {
+		t.Errorf("conflictFrom returned %v for a single wanted", from)
+	}
+}
+
+func TestConflictsReport(t *testing.T) {
+	found := testConflictSources().Conflicts()
+	cases := []struct {
+		JSON     bool
+		found    []*DependencySource
+		expected string
+	}{
+		{false, nil, "No conflicts\n"},
+		{true, nil, "[]\n"},
+		{false, found, "1 conflicting dependencies:\ntest.com/a\n\trevisions:\n\t\tabc (on disk)\n\t\tdef wanted by test.com/b\n"},
+		{true, found, `[
+    {
+        "Root": "test.com/a",
+        "OnDiskRevision": "abc",
+        "Revisions": {
+            "abc": [],
+            "def": [
+                "test.com/b"
+            ]
+        }
+    }
+]
+`},
+	}
+	for _, c := range cases {
+		out := &bytes.Buffer{}
+		if err := (&Conflicts{JSON: c.JSON}).Report(out, c.found); err != nil {
+			t.Errorf("Report returned error %s", err.Error())
+		}
+		if out.String() != c.expected {
+			t.Errorf("Report json %v expected:\n%s\ngot:\n%s", c.JSON, c.expected, out.String())
+		}
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-conflicts")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	a := newTestGitRepo(t, gopath, "test.com/a")
+	old := a.commit("a.go", "package a\n")
+	head := a.commit("a.go", "package a\n\nconst A = 1\n")
+	b := newTestGitRepo(t, gopath, "test.com/b")
+	b.write("b.go", "package b\n\nimport _ \"test.com/a\"\n")
+	cdeps := []*CanticleDependency{{Root: "test.com/a", Revision: old}}
+	if err := WriteCanticleFile(DependencyFile(b.dir), NewCanticleFile("test.com/b", cdeps)); err != nil {
+		t.Fatalf("Error writing Canticle file: %s", err.Error())
+	}
+	b.git("add", ".")
+	b.git("commit", "-q", "-m", "b")
+	app := newTestGitRepo(t, gopath, "test.com/app")
+	app.write("app.go", "package app\n\nimport (\n\t_ \"test.com/a\"\n\t_ \"test.com/b\"\n)\n")
+
+	c := NewConflicts()
+	c.Resolvers.Chain, _ = ParseResolverChain("local")
+	found, err := c.FindConflicts(gopath, app.dir)
+	if err != nil {
+		t.Fatalf("FindConflicts returned error %s", err.Error())
+	}
+	if len(found) != 1 || found[0].Root != "test.com/a" {
+		t.Fatalf("FindConflicts expected test.com/a got %+v", found)
+	}
+	expected := map[string][]string{head: {}, old: {"test.com/b"}}
+	if revs := NewDependencyConflict(found[0]).Revisions; !reflect.DeepEqual(revs, expected) {
+		t.Errorf("FindConflicts expected revisions %v got %v", expected, revs)
+	}
+
+	if err := WriteCanticleFile(DependencyFile(b.dir), NewCanticleFile("test.com/b", nil)); err != nil {
+		t.Fatalf("Error writing Canticle file: %s", err.Error())
+	}
+	if found, err := c.FindConflicts(gopath, app.dir); err != nil || len(found) != 0 {
+		t.Errorf("FindConflicts expected no conflicts got %+v %v", found, err)
+	}
+}
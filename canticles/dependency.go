@@ -1,6 +1,9 @@
 package canticles
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // A Dependency defines all information about this package.
 type Dependency struct {
@@ -11,15 +14,30 @@ type Dependency struct {
 	ImportedFrom StringSet
 	// Imports is the set of remote imports for this dep.
 	Imports StringSet
+	// ImportPlatforms maps each import to the platforms it is
+	// imported on, if read under a platform matrix.
+	ImportPlatforms map[string]StringSet
+	// Platforms is the set of platforms this dep is needed on. It
+	// is empty if no platform matrix was used.
+	Platforms StringSet
+	// TestImports is the subset of Imports only imported by test
+	// files.
+	TestImports StringSet
+	// Scope this dep is needed in, one of ScopeRuntime, ScopeTest
+	// or ScopeTool.
+	Scope string
 	// Attempt to read the package caused an error.
 	Err error
 }
 
 func NewDependency(importPath string) *Dependency {
 	return &Dependency{
-		ImportedFrom: NewStringSet(),
-		Imports:      NewStringSet(),
-		ImportPath:   importPath,
+		ImportedFrom:    NewStringSet(),
+		Imports:         NewStringSet(),
+		ImportPlatforms: make(map[string]StringSet),
+		Platforms:       NewStringSet(),
+		TestImports:     NewStringSet(),
+		ImportPath:      importPath,
 	}
 }
 
@@ -54,7 +72,35 @@ func (d Dependencies) AddDependency(dep *Dependency) {
 
 	already.Err = dep.Err
 	already.ImportedFrom.Union(dep.ImportedFrom)
+	// An import is only a test import if it is a test import
+	// everywhere it is imported.
+	isTest := func(d *Dependency, imp string) bool {
+		return !d.Imports[imp] || d.TestImports[imp]
+	}
+	testImports := NewStringSet()
+	for _, d := range []*Dependency{already, dep} {
+		for imp := range d.Imports {
+			if isTest(already, imp) && isTest(dep, imp) {
+				testImports.Add(imp)
+			}
+		}
+	}
+	already.TestImports = testImports
 	already.Imports.Union(dep.Imports)
+	already.Scope = WiderScope(already.Scope, dep.Scope)
+	if already.Platforms == nil {
+		already.Platforms = NewStringSet()
+	}
+	already.Platforms.Union(dep.Platforms)
+	if already.ImportPlatforms == nil {
+		already.ImportPlatforms = make(map[string]StringSet)
+	}
+	for imp, platforms := range dep.ImportPlatforms {
+		if already.ImportPlatforms[imp] == nil {
+			already.ImportPlatforms[imp] = NewStringSet()
+		}
+		already.ImportPlatforms[imp].Union(platforms)
+	}
 }
 
 func (d Dependencies) AddDeps(deps ...string) {
@@ -65,6 +111,70 @@ func (d Dependencies) AddDeps(deps ...string) {
 	}
 }
 
+// PropagatePlatforms sets the Platforms of each dependency to the
+// platforms it is needed on. Dependencies for which isRoot returns
+// true are needed on all platforms, every other dependency is needed
+// on the platforms of its importers it is imported under.
+func (d Dependencies) PropagatePlatforms(all []string, isRoot func(dep *Dependency) bool) {
+	var queue []string
+	for path, dep := range d {
+		dep.Platforms = NewStringSet()
+		if isRoot(dep) {
+			dep.Platforms.Add(all...)
+			queue = append(queue, path)
+		}
+	}
+	for len(queue) > 0 {
+		dep := d[queue[0]]
+		queue = queue[1:]
+		for imp := range dep.Imports {
+			child := d[imp]
+			if child == nil {
+				continue
+			}
+			size := child.Platforms.Size()
+			edge := dep.ImportPlatforms[imp]
+			for platform := range dep.Platforms {
+				if edge.Size() == 0 || edge[platform] {
+					child.Platforms.Add(platform)
+				}
+			}
+			if child.Platforms.Size() != size {
+				queue = append(queue, imp)
+			}
+		}
+	}
+}
+
+// PropagateScopes sets the Scope of each dependency. Dependencies for
+// which isRoot returns true, and everything they reach through
+// non test imports, are ScopeRuntime. Dependencies already marked
+// ScopeTool are left as is and everything else is ScopeTest.
+func (d Dependencies) PropagateScopes(isRoot func(dep *Dependency) bool) {
+	var queue []string
+	for path, dep := range d {
+		if dep.Scope != ScopeTool {
+			dep.Scope = ScopeTest
+		}
+		if isRoot(dep) {
+			dep.Scope = ScopeRuntime
+			queue = append(queue, path)
+		}
+	}
+	for len(queue) > 0 {
+		dep := d[queue[0]]
+		queue = queue[1:]
+		for imp := range dep.Imports {
+			child := d[imp]
+			if child == nil || child.Scope == ScopeRuntime || dep.TestImports[imp] {
+				continue
+			}
+			child.Scope = ScopeRuntime
+			queue = append(queue, imp)
+		}
+	}
+}
+
 // String will print this out as newline seperated %+v values.
 func (d Dependencies) String() string {
 	str := ""
@@ -74,6 +184,47 @@ func (d Dependencies) String() string {
 	return str
 }
 
+// Scopes a CanticleDependency may be needed in. Runtime
+// dependencies are imported by non test files, test dependencies
+// only by test files and tool dependencies are binaries needed to
+// build or develop the project.
+const (
+	ScopeRuntime = "runtime"
+	ScopeTest    = "test"
+	ScopeTool    = "tool"
+)
+
+var scopeRanks = map[string]int{ScopeTest: 1, ScopeTool: 2, ScopeRuntime: 3}
+
+// WiderScope returns whichever of a and b is needed in more builds,
+// runtime being wider than tool and tool wider than test.
+func WiderScope(a, b string) string {
+	if scopeRanks[b] > scopeRanks[a] {
+		return b
+	}
+	return a
+}
+
+// ScopeFlags is a flag.Value of a comma seperated list of scopes.
+type ScopeFlags StringSet
+
+func (sf ScopeFlags) String() string {
+	return strings.Join(StringSet(sf).Array(), ",")
+}
+
+// Set adds the comma seperated scopes in v, returning an error for
+// unknown scopes.
+func (sf ScopeFlags) Set(v string) error {
+	for _, scope := range strings.Split(v, ",") {
+		scope = strings.TrimSpace(scope)
+		if _, ok := scopeRanks[scope]; !ok {
+			return fmt.Errorf("unknown scope %q, must be one of %s, %s or %s", scope, ScopeRuntime, ScopeTest, ScopeTool)
+		}
+		StringSet(sf).Add(scope)
+	}
+	return nil
+}
+
 type CanticleDependency struct {
 	// SourcePath is the source of the dependencies VCS
 	SourcePath string `json:",omitempty"`
@@ -82,9 +233,42 @@ type CanticleDependency struct {
 	Root string
 	// Revision is the VCS specific commit id
 	Revision string `json:",omitempty"`
+	// Branch the locked Revision was resolved from, only set in
+	// lock files.
+	Branch string `json:",omitempty"`
+	// Hash of the tree committed at Revision, see HashTree. Only
+	// set in lock files.
+	Hash string `json:",omitempty"`
 	// All means walks this VCS from the root for nonhidden files. This will save and
 	// fetch the subdirs of package.
 	All bool `json:",omitempty"`
+	// Platforms this dependency is needed on, if saved with a
+	// platform matrix. Empty means all platforms.
+	Platforms []string `json:",omitempty"`
+	// Scope is the scope this dependency is needed in. Empty is
+	// the same as ScopeRuntime.
+	Scope string `json:",omitempty"`
+	// Tools are the import paths of commands in this dependency to
+	// install with cant tools install.
+	Tools []string `json:",omitempty"`
+	// Signature, if set, requires the Revision be signed by a
+	// trusted key when fetched.
+	Signature *SignaturePolicy `json:",omitempty"`
+}
+
+// DepScope returns the scope of this dependency, ScopeRuntime if
+// unset.
+func (cd *CanticleDependency) DepScope() string {
+	if cd.Scope == "" {
+		return ScopeRuntime
+	}
+	return cd.Scope
+}
+
+// InScopes returns true if this dependency is in scopes, or scopes
+// is empty.
+func (cd *CanticleDependency) InScopes(scopes StringSet) bool {
+	return scopes.Size() == 0 || scopes[cd.DepScope()]
 }
 
 type CanticleDependencies []*CanticleDependency
@@ -1,7 +1,113 @@
 package canticles
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestDependenciesAddDependency(t *testing.T) {
 
 }
+
+func TestPropagatePlatforms(t *testing.T) {
+	all := []string{"linux/amd64", "windows/amd64"}
+	deps := NewDependencies()
+	root := NewDependency("test.com/root")
+	root.Imports.Add("test.com/a", "test.com/win")
+	root.ImportPlatforms["test.com/a"] = NewStringSet()
+	root.ImportPlatforms["test.com/a"].Add(all...)
+	root.ImportPlatforms["test.com/win"] = NewStringSet()
+	root.ImportPlatforms["test.com/win"].Add("windows/amd64")
+	a := NewDependency("test.com/a")
+	a.Imports.Add("test.com/b")
+	a.ImportedFrom.Add("test.com/root")
+	win := NewDependency("test.com/win")
+	win.Imports.Add("test.com/b", "test.com/c")
+	win.ImportedFrom.Add("test.com/root")
+	b := NewDependency("test.com/b")
+	b.ImportedFrom.Add("test.com/a", "test.com/win")
+	c := NewDependency("test.com/c")
+	c.ImportedFrom.Add("test.com/win")
+	deps.AddDependency(root)
+	deps.AddDependency(a)
+	deps.AddDependency(win)
+	deps.AddDependency(b)
+	deps.AddDependency(c)
+
+	deps.PropagatePlatforms(all, func(dep *Dependency) bool { return dep.ImportPath == "test.com/root" })
+	expected := map[string][]string{
+		"test.com/root": all,
+		"test.com/a":    all,
+		"test.com/b":    all,
+		"test.com/win":  {"windows/amd64"},
+		"test.com/c":    {"windows/amd64"},
+	}
+	for path, platforms := range expected {
+		if !reflect.DeepEqual(platforms, deps[path].Platforms.Array()) {
+			t.Errorf("PropagatePlatforms %s got %v expected %v", path, deps[path].Platforms.Array(), platforms)
+		}
+	}
+}
+
+func TestPropagateScopes(t *testing.T) {
+	deps := NewDependencies()
+	root := NewDependency("test.com/root")
+	root.Imports.Add("test.com/lib", "test.com/assert")
+	root.TestImports.Add("test.com/assert")
+	lib := NewDependency("test.com/lib")
+	lib.Imports.Add("test.com/assert", "test.com/util")
+	lib.TestImports.Add("test.com/assert")
+	util := NewDependency("test.com/util")
+	assert := NewDependency("test.com/assert")
+	assert.Imports.Add("test.com/util", "test.com/diff")
+	diff := NewDependency("test.com/diff")
+	lint := NewDependency("test.com/lint")
+	lint.Scope = ScopeTool
+	for _, dep := range []*Dependency{root, lib, util, assert, diff, lint} {
+		deps.AddDependency(dep)
+	}
+
+	deps.PropagateScopes(func(dep *Dependency) bool { return dep.ImportPath == "test.com/root" })
+	expected := map[string]string{
+		"test.com/root":   ScopeRuntime,
+		"test.com/lib":    ScopeRuntime,
+		"test.com/util":   ScopeRuntime,
+		"test.com/assert": ScopeTest,
+		"test.com/diff":   ScopeTest,
+		"test.com/lint":   ScopeTool,
+	}
+	for path, scope := range expected {
+		if deps[path].Scope != scope {
+			t.Errorf("PropagateScopes %s got scope %s expected %s", path, deps[path].Scope, scope)
+		}
+	}
+
+	// An import made by non test files anywhere is not a test import
+	other := NewDependency("test.com/root")
+	other.Imports.Add("test.com/assert")
+	deps.AddDependency(other)
+	if root.TestImports.Size() != 0 {
+		t.Errorf("AddDependency kept test import also made by non test files %v", root.TestImports)
+	}
+}
+
+func TestScopeFlags(t *testing.T) {
+	sf := ScopeFlags(NewStringSet())
+	if err := sf.Set("runtime, tool"); err != nil {
+		t.Fatalf("ScopeFlags error setting valid scopes: %s", err.Error())
+	}
+	if sf.String() != "runtime,tool" {
+		t.Errorf("ScopeFlags String returned %s", sf.String())
+	}
+	if err := sf.Set("prod"); err == nil {
+		t.Errorf("ScopeFlags returned no error for unknown scope")
+	}
+	cdep := &CanticleDependency{Root: "test.com/a"}
+	if !cdep.InScopes(StringSet(sf)) || !cdep.InScopes(NewStringSet()) {
+		t.Errorf("CanticleDependency without scope should be in runtime scope")
+	}
+	cdep.Scope = ScopeTest
+	if cdep.InScopes(StringSet(sf)) {
+		t.Errorf("CanticleDependency with test scope should not be in runtime,tool")
+	}
+}
@@ -1,31 +1,51 @@
 package canticles
 
 import (
-	"encoding/json"
 	"os"
+	"sort"
 )
 
 // DepReader works in a particular gopath to read the
-// dependencies of both Canticle and non-Canticle go packages.
+// dependencies of both Canticle and non-Canticle go packages. If
+// Platforms is set go imports are read under each context and
+// unioned.
 type DepReader struct {
-	Gopath string
+	Gopath    string
+	Platforms BuildContexts
+	// Scopes limits the dependencies read to these scopes, all
+	// scopes are read if empty.
+	Scopes StringSet
 }
 
-// ReadCanticleDependencies returns the dependencies listed in the
-// packages Canticle file. Dependencies will never be nil.
+// CanticleDependencies returns the dependencies the package is
+// locked to in its Canticle.lock, or if it has no lock file those
+// listed in its Canticle file.
 func (dr *DepReader) CanticleDependencies(pkg string) ([]*CanticleDependency, error) {
-	var deps []*CanticleDependency
-	f, err := os.Open(DependencyFile(PackageSource(dr.Gopath, pkg)))
-	if err != nil {
-		return deps, err
+	deps, err := dr.LockedDependencies(pkg)
+	if err != nil && os.IsNotExist(err) {
+		return dr.IntentDependencies(pkg)
 	}
-	LogVerbose("Reading canticle file: %s", f.Name())
-	defer f.Close()
-	d := json.NewDecoder(f)
-	if err := d.Decode(&deps); err != nil {
-		return deps, err
+	return deps, err
+}
+
+// IntentDependencies returns the dependencies listed in the packages
+// Canticle file, in either the legacy or current format.
+func (dr *DepReader) IntentDependencies(pkg string) ([]*CanticleDependency, error) {
+	return readCanticleDeps(DependencyFile(PackageSource(dr.Gopath, pkg)))
+}
+
+// LockedDependencies returns the dependencies listed in the packages
+// Canticle.lock.
+func (dr *DepReader) LockedDependencies(pkg string) ([]*CanticleDependency, error) {
+	return readCanticleDeps(LockFile(PackageSource(dr.Gopath, pkg)))
+}
+
+func readCanticleDeps(path string) ([]*CanticleDependency, error) {
+	cf, err := LoadCanticleFile(path)
+	if err != nil {
+		return []*CanticleDependency{}, err
 	}
-	return deps, nil
+	return cf.Deps, nil
 }
 
 func (dr *DepReader) AllImports(path string) ([]string, error) {
@@ -55,26 +75,115 @@ func (dr *DepReader) AllDeps(path string) (Dependencies, error) {
 		return allDeps, err
 	}
 	for _, cdep := range cdeps {
-		if cdep.All {
+		if cdep.All && cdep.InScopes(dr.Scopes) {
 			allDeps.AddDeps(cdep.Root)
+			allDeps[cdep.Root].Scope = cdep.DepScope()
 		}
 	}
 	// If this is a dir attempt to read its deps, ignore if it has
 	// no go files
-	goDeps, err := dr.GoRemoteDependencies(pname)
+	goDeps, err := dr.GoRemoteImports(pname)
 	if err != nil {
 		return allDeps, err
 	}
-	allDeps.AddDeps(goDeps...)
+	for imp, ri := range goDeps {
+		allDeps.AddDeps(imp)
+		dep := allDeps[imp]
+		dep.Platforms.Union(ri.Platforms)
+		if ri.Test && dep.Scope == "" {
+			dep.Scope = ScopeTest
+		} else if !ri.Test {
+			dep.Scope = ScopeRuntime
+		}
+	}
 	return allDeps, nil
 }
 
 // ReadGoRemoteDependencies reads the dependencies for package p listed
 // as imports in *.go files, including tests, and returns the result.
 func (dr *DepReader) GoRemoteDependencies(importPath string) ([]string, error) {
-	pkg, err := LoadPackage(importPath, dr.Gopath)
+	deps, err := dr.GoRemoteImports(importPath)
 	if err != nil {
 		return []string{}, err
 	}
-	return pkg.RemoteImports(true), nil
+	imports := make([]string, 0, len(deps))
+	for imp := range deps {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	return imports, nil
+}
+
+// GoRemoteDependencyPlatforms reads the remote imports of importPath
+// and returns a map of import to the platforms it is imported on.
+func (dr *DepReader) GoRemoteDependencyPlatforms(importPath string) (map[string]StringSet, error) {
+	deps := make(map[string]StringSet)
+	imports, err := dr.GoRemoteImports(importPath)
+	for imp, ri := range imports {
+		deps[imp] = ri.Platforms
+	}
+	return deps, err
+}
+
+// A RemoteImport describes how a package imports a remote package.
+type RemoteImport struct {
+	// Platforms the import is made on, empty if no platform
+	// matrix was used.
+	Platforms StringSet
+	// Test is true if the import is only made by test files.
+	Test bool
+}
+
+func (ri *RemoteImport) add(platform string, test bool) {
+	ri.Platforms.Add(platform)
+	ri.Test = ri.Test && test
+}
+
+// GoRemoteImports reads the remote imports of importPath under each
+// of the readers Platforms. Platforms on which the package has no
+// buildable files are skipped. If no Platforms are set the default
+// build context is used. Test imports are only read if Scopes is
+// empty or contains ScopeTest.
+func (dr *DepReader) GoRemoteImports(importPath string) (map[string]*RemoteImport, error) {
+	deps := make(map[string]*RemoteImport)
+	contexts := dr.Platforms
+	if len(contexts) == 0 {
+		contexts = BuildContexts{nil}
+	}
+	tests := dr.Scopes.Size() == 0 || dr.Scopes[ScopeTest]
+
+	var lastErr error
+	loaded := false
+	for _, ctx := range contexts {
+		pkg, err := LoadPackageContext(importPath, dr.Gopath, ctx)
+		if err != nil {
+			if e, ok := err.(*PackageError); ok && e.IsNoBuildable() && len(dr.Platforms) > 0 {
+				LogVerbose("Package %s not buildable on %s", importPath, ctx.String())
+				lastErr = err
+				continue
+			}
+			return deps, err
+		}
+		loaded = true
+		platform := ""
+		if ctx != nil {
+			platform = ctx.String()
+		}
+		add := func(imports []string, test bool) {
+			for _, imp := range imports {
+				if deps[imp] == nil {
+					deps[imp] = &RemoteImport{Platforms: NewStringSet(), Test: true}
+				}
+				deps[imp].add(platform, test)
+			}
+		}
+		add(pkg.RemoteImports(false), false)
+		if tests {
+			add(pkg.RemoteTestImports(), true)
+		}
+	}
+	if !loaded && lastErr != nil {
+		return deps, lastErr
+	}
+	return deps, nil
 }
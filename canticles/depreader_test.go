@@ -10,7 +10,7 @@ import (
 )
 
 func TestCanticleDependencies(t *testing.T) {
-	dr := &DepReader{os.ExpandEnv("$GOPATH")}
+	dr := &DepReader{Gopath: os.ExpandEnv("$GOPATH")}
 
 	// Happy path
 	deps, err := dr.CanticleDependencies("github.com/Comcast/Canticle")
@@ -110,7 +110,7 @@ func TestReadAllDeps(t *testing.T) {
 	}
 
 	// Setup all complete, lets read all our Canticle deps
-	dr := &DepReader{dir}
+	dr := &DepReader{Gopath: dir}
 
 	// Happy path
 	result, err := dr.ReadAllCantDeps("canttest")
@@ -174,7 +174,7 @@ func TestReadAllRemoteDeps(t *testing.T) {
 	}
 	//defer os.Remove(dir)
 	// Setup all complete, lets read all our Canticle deps
-	dr := &DepReader{dir}
+	dr := &DepReader{Gopath: dir}
 
 	result, err := dr.ReadAllRemoteDependencies("test.com/cubicle")
 	if err != nil {
@@ -190,7 +190,7 @@ func TestReadAllRemoteDeps(t *testing.T) {
 }
 
 func TestReadRemoteDependencies(t *testing.T) {
-	dr := &DepReader{os.ExpandEnv("$GOPATH")}
+	dr := &DepReader{Gopath: os.ExpandEnv("$GOPATH")}
 
 	// Happy path
 	deps, err := dr.ReadRemoteDependencies("github.com/Comcast/Canticle")
@@ -224,7 +224,7 @@ func TestReadRemoteDependencies(t *testing.T) {
 }
 */
 func TestReadDependencies(t *testing.T) {
-	dr := &DepReader{os.ExpandEnv("$GOPATH")}
+	dr := &DepReader{Gopath: os.ExpandEnv("$GOPATH")}
 
 	// Happy path
 	deps, err := dr.GoRemoteDependencies("github.com/Comcast/Canticle/cant")
@@ -298,3 +298,136 @@ func TestReadDependencies(t *testing.T) {
 		t.Errorf("ReadRemoteDependencies returned %+v expected %+v", deps[1], expected)
 	}
 }
+
+func TestGoRemoteDependencyPlatforms(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-platform")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	files := map[string]string{
+		"test.com/plat/plat.go":         "package plat\n\nimport _ \"test.com/all\"\n",
+		"test.com/plat/plat_windows.go": "package plat\n\nimport _ \"test.com/win\"\n",
+		"test.com/plat/plat_tagged.go":  "// +build integration\n\npackage plat\n\nimport _ \"test.com/tagged\"\n",
+		"test.com/winonly/w_windows.go": "package winonly\n",
+	}
+	for name, body := range files {
+		p := PackageSource(gopath, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatalf("Error creating package dir: %s", err.Error())
+		}
+		if err := ioutil.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatalf("Error writing package file: %s", err.Error())
+		}
+	}
+	dr := &DepReader{Gopath: gopath}
+	if err := dr.Platforms.Set("linux/amd64 windows/amd64 linux/amd64:integration"); err != nil {
+		t.Fatalf("Error setting platforms: %s", err.Error())
+	}
+	deps, err := dr.GoRemoteDependencyPlatforms("test.com/plat")
+	if err != nil {
+		t.Fatalf("GoRemoteDependencyPlatforms returned error for valid package: %s", err.Error())
+	}
+	expected := map[string][]string{
+		"test.com/all":    {"linux/amd64", "linux/amd64:integration", "windows/amd64"},
+		"test.com/win":    {"windows/amd64"},
+		"test.com/tagged": {"linux/amd64:integration"},
+	}
+	if len(deps) != len(expected) {
+		t.Errorf("GoRemoteDependencyPlatforms returned %v expected %v", deps, expected)
+	}
+	for imp, platforms := range expected {
+		if !reflect.DeepEqual(platforms, deps[imp].Array()) {
+			t.Errorf("GoRemoteDependencyPlatforms %s got %v expected %v", imp, deps[imp].Array(), platforms)
+		}
+	}
+
+	if _, err := dr.GoRemoteDependencyPlatforms("test.com/winonly"); err != nil {
+		t.Errorf("GoRemoteDependencyPlatforms returned error for package buildable on one platform: %s", err.Error())
+	}
+	dr.Platforms = dr.Platforms[:1]
+	_, err = dr.GoRemoteDependencyPlatforms("test.com/winonly")
+	if e, ok := err.(*PackageError); !ok || !e.IsNoBuildable() {
+		t.Errorf("GoRemoteDependencyPlatforms expected no buildable error got %v", err)
+	}
+}
+
+func TestGoRemoteImportsScopes(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-scope")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	files := map[string]string{
+		"test.com/scoped/scoped.go":      "package scoped\n\nimport _ \"test.com/lib\"\n",
+		"test.com/scoped/scoped_test.go": "package scoped\n\nimport _ \"test.com/lib\"\nimport _ \"test.com/assert\"\n",
+		"test.com/scoped/x_test.go":      "package scoped_test\n\nimport _ \"test.com/scoped\"\nimport _ \"test.com/mock\"\n",
+	}
+	for name, body := range files {
+		p := PackageSource(gopath, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatalf("Error creating package dir: %s", err.Error())
+		}
+		if err := ioutil.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatalf("Error writing package file: %s", err.Error())
+		}
+	}
+	dr := &DepReader{Gopath: gopath}
+	imports, err := dr.GoRemoteImports("test.com/scoped")
+	if err != nil {
+		t.Fatalf("GoRemoteImports returned error for valid package: %s", err.Error())
+	}
+	expected := map[string]bool{"test.com/lib": false, "test.com/assert": true, "test.com/mock": true}
+	if len(imports) != len(expected) {
+		t.Errorf("GoRemoteImports returned %d imports expected %d", len(imports), len(expected))
+	}
+	for imp, test := range expected {
+		if imports[imp] == nil || imports[imp].Test != test {
+			t.Errorf("GoRemoteImports %s got %+v expected test %v", imp, imports[imp], test)
+		}
+	}
+
+	dr.Scopes = NewStringSet()
+	dr.Scopes.Add(ScopeRuntime)
+	deps, err := dr.GoRemoteDependencies("test.com/scoped")
+	if err != nil {
+		t.Fatalf("GoRemoteDependencies returned error for valid package: %s", err.Error())
+	}
+	if !reflect.DeepEqual([]string{"test.com/lib"}, deps) {
+		t.Errorf("GoRemoteDependencies with runtime scope returned %v", deps)
+	}
+}
+
+func TestCanticleDependenciesLock(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-lock")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	dir := PackageSource(gopath, "test.com/locked")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Error creating package dir: %s", err.Error())
+	}
+	intent := []*CanticleDependency{{Root: "test.com/a", Revision: "master"}}
+	if err := WriteCanticleFile(DependencyFile(dir), NewCanticleFile("test.com/locked", intent)); err != nil {
+		t.Fatalf("Error writing Canticle file: %s", err.Error())
+	}
+	dr := &DepReader{Gopath: gopath}
+	deps, err := dr.CanticleDependencies("test.com/locked")
+	if err != nil || !reflect.DeepEqual(intent, deps) {
+		t.Errorf("CanticleDependencies without lock returned %+v %v expected %+v", deps, err, intent)
+	}
+
+	locked := []*CanticleDependency{{Root: "test.com/a", Revision: "abc", Branch: "master"}}
+	if err := WriteCanticleFile(LockFile(dir), NewCanticleFile("test.com/locked", locked)); err != nil {
+		t.Fatalf("Error writing Canticle.lock: %s", err.Error())
+	}
+	deps, err = dr.CanticleDependencies("test.com/locked")
+	if err != nil || !reflect.DeepEqual(locked, deps) {
+		t.Errorf("CanticleDependencies with lock returned %+v %v expected %+v", deps, err, locked)
+	}
+	deps, err = dr.IntentDependencies("test.com/locked")
+	if err != nil || !reflect.DeepEqual(intent, deps) {
+		t.Errorf("IntentDependencies returned %+v %v expected %+v", deps, err, intent)
+	}
+}
@@ -11,10 +11,21 @@ import (
 type DependencySource struct {
 	// Revisions specified by canticle files
 	Revisions StringSet
+	// RevisionsFrom are the paths of the canticle files which
+	// specified each revision.
+	RevisionsFrom map[string]StringSet
 	// OnDiskRevision for this VCS
 	OnDiskRevision string
+	// OnDiskCommit is the exact revision on disk, even if
+	// OnDiskRevision is a branch.
+	OnDiskCommit string
+	// OnDiskBranch is the branch on disk, if any.
+	OnDiskBranch string
 	// Sources specified for this VCS.
 	Sources StringSet
+	// SourcesFrom are the paths of the canticle files which
+	// specified each source.
+	SourcesFrom map[string]StringSet
 	// OnDiskSource for this VCS.
 	OnDiskSource string
 	// Deps contained by this VCS system.
@@ -29,10 +40,12 @@ type DependencySource struct {
 // disk.
 func NewDependencySource(root string) *DependencySource {
 	return &DependencySource{
-		Root:      root,
-		Deps:      NewDependencies(),
-		Revisions: NewStringSet(),
-		Sources:   NewStringSet(),
+		Root:          root,
+		Deps:          NewDependencies(),
+		Revisions:     NewStringSet(),
+		RevisionsFrom: make(map[string]StringSet),
+		Sources:       NewStringSet(),
+		SourcesFrom:   make(map[string]StringSet),
 	}
 }
 
@@ -40,11 +53,48 @@ func NewDependencySource(root string) *DependencySource {
 func (d *DependencySource) AddCantSource(source *CanticleDependency, path string) {
 	d.Revisions.Add(source.Revision)
 	d.Sources.Add(source.SourcePath)
+	addFrom(d.RevisionsFrom, source.Revision, path)
+	addFrom(d.SourcesFrom, source.SourcePath, path)
 	dep := NewDependency(path)
 	dep.Imports.Add(source.Root)
 	d.Deps.AddDependency(dep)
 }
 
+func addFrom(from map[string]StringSet, value, path string) {
+	if from[value] == nil {
+		from[value] = NewStringSet()
+	}
+	from[value].Add(path)
+}
+
+// ConflictingRevisions returns the non empty revisions wanted for
+// this source, with compatible version constraints intersected.
+func (d *DependencySource) ConflictingRevisions() []string {
+	return IntersectRevisions(nonEmpty(d.Revisions))
+}
+
+// ConflictingSources returns the non empty sources wanted for this
+// source.
+func (d *DependencySource) ConflictingSources() []string {
+	return nonEmpty(d.Sources)
+}
+
+// Conflicted returns true if more than one revision or source is
+// wanted for this source.
+func (d *DependencySource) Conflicted() bool {
+	return len(d.ConflictingRevisions()) > 1 || len(d.ConflictingSources()) > 1
+}
+
+func nonEmpty(ss StringSet) []string {
+	result := make([]string, 0, len(ss))
+	for _, s := range ss.Array() {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 // DependencySources represents a collection of dependencysources,
 // including functionality to lookup deps that may be rooted in other
 // deps.
@@ -69,6 +119,17 @@ func (ds *DependencySources) DepSource(importPath string) *DependencySource {
 	return nil
 }
 
+// Conflicts returns the sources which are Conflicted.
+func (ds *DependencySources) Conflicts() []*DependencySource {
+	var conflicts []*DependencySource
+	for _, source := range ds.Sources {
+		if source.Conflicted() {
+			conflicts = append(conflicts, source)
+		}
+	}
+	return conflicts
+}
+
 // AddSource appends this DependencySource to our collection.
 func (ds *DependencySources) AddSource(source *DependencySource) {
 	ds.Sources = append(ds.Sources, source)
@@ -128,21 +189,27 @@ func (sr *SourcesResolver) ResolveSources(deps Dependencies) (*DependencySources
 		}
 		source := NewDependencySource(root)
 
-		var rev string
-		if sr.Branches {
-			rev, err = vcs.GetBranch()
-			if err != nil {
+		branch, err := vcs.GetBranch()
+		if err != nil {
+			if sr.Branches {
 				LogWarn("\t\tNo branch from vcs at %s %s", root, err.Error())
+			} else {
+				LogVerbose("\t\tNo branch from vcs at %s %s", root, err.Error())
 			}
+			branch = ""
 		}
-		if !sr.Branches || err != nil {
-			rev, err = vcs.GetRev()
-			if err != nil {
-				return nil, fmt.Errorf("cant get revision from vcs at %s %s", root, err.Error())
-			}
+		commit, err := vcs.GetRev()
+		if err != nil {
+			return nil, fmt.Errorf("cant get revision from vcs at %s %s", root, err.Error())
+		}
+		rev := commit
+		if sr.Branches && branch != "" {
+			rev = branch
 		}
 		source.Revisions.Add(rev)
 		source.OnDiskRevision = rev
+		source.OnDiskCommit = commit
+		source.OnDiskBranch = branch
 
 		if sr.Sources {
 			LogVerbose("\t\tGetting source for VCS: %s", root)
@@ -84,13 +84,16 @@ func (dw *DependencyWalker) TraverseDependencies(pkg string) error {
 type DependencyReader func(importPath string) (Dependencies, error)
 
 // A DependencyLoader fetches and set the correct revision for a
-// dependency using the specified resolver.
+// dependency using the specified resolver. Repos with a Revision in
+// cdeps are checked out at it, once each, even if already on disk.
 type DependencyLoader struct {
 	deps     Dependencies
 	cdeps    []*CanticleDependency
 	gopath   string
 	resolver RepoResolver
 	readDeps DependencyReader
+	pinned   StringSet
+	unpinned StringSet
 }
 
 // NewDependencyLoader returns a DependencyLoader initialized with the
@@ -102,6 +105,8 @@ func NewDependencyLoader(resolver RepoResolver, depReader DependencyReader, cdep
 		resolver: resolver,
 		cdeps:    cdeps,
 		gopath:   gopath,
+		pinned:   NewStringSet(),
+		unpinned: NewStringSet(),
 	}
 }
 
@@ -128,9 +133,10 @@ func (dl *DependencyLoader) FetchUpdatePackage(pkg string) error {
 
 	// Fetch the package
 	LogVerbose("DepLoader check path: %s", path)
-	if !ondisk {
+	cdep := dl.cdepForPkg(pkg)
+	switch {
+	case !ondisk:
 		// Resolve the vcs using our cdep if available
-		cdep := dl.cdepForPkg(pkg)
 		LogVerbose("Resolving repo for %s ondisk %v path %s", pkg, ondisk, path)
 		vcs, err := dl.resolver.ResolveRepo(pkg, cdep)
 		if err != nil {
@@ -140,6 +146,21 @@ func (dl *DependencyLoader) FetchUpdatePackage(pkg string) error {
 		if err := dl.fetchPackage(vcs, cdep); err != nil {
 			return fmt.Errorf("cant fetch package %s %s", pkg, err.Error())
 		}
+		if cdep == nil || cdep.Revision == "" {
+			dl.unpinned.Add(vcs.GetRoot())
+		}
+	case cdep != nil && cdep.Revision != "" && !dl.pinned[cdep.Root]:
+		// Already on disk, make sure it is at the pinned revision
+		vcs, err := dl.resolver.ResolveRepo(pkg, cdep)
+		if err != nil {
+			return fmt.Errorf("%s version control %s", pkg, err.Error())
+		}
+		if err := dl.setRevision(vcs, cdep); err != nil {
+			return fmt.Errorf("cant set revision of package %s %s", pkg, err.Error())
+		}
+	}
+	if cdep != nil && cdep.Revision != "" {
+		dl.pinned.Add(cdep.Root)
 	}
 
 	// Load all the deps for this file directly
@@ -183,19 +204,37 @@ func (dl *DependencyLoader) PackageImports(pkg string) ([]string, error) {
 	return dep.Imports.Array(), nil
 }
 
+// Unpinned returns the roots fetched without a Revision in cdeps,
+// they are at the default revision of their VCS.
+func (dl *DependencyLoader) Unpinned() []string {
+	return dl.unpinned.Array()
+}
+
+// Dependencies returns the dependencies read by the loader.
+func (dl *DependencyLoader) Dependencies() Dependencies {
+	return dl.deps
+}
+
 func (dl *DependencyLoader) setRevision(vcs VCS, dep *CanticleDependency) error {
 	LogVerbose("Setting rev on dep %+v", dep)
-	if err := vcs.SetRev(""); err != nil {
+	if err := vcs.SetRev(dep.Revision); err != nil {
 		return fmt.Errorf("failed to set revision because %s", err.Error())
 	}
-	return nil
+	return VerifyHash(dl.gopath, dep)
 }
 
 func (dl *DependencyLoader) fetchPackage(vcs VCS, dep *CanticleDependency) error {
 	LogVerbose("Fetching dep %+v", dep)
-	if err := vcs.Create(""); err != nil {
+	rev := ""
+	if dep != nil {
+		rev = dep.Revision
+	}
+	if err := vcs.Create(rev); err != nil {
 		return fmt.Errorf("failed to fetch because %s", err.Error())
 	}
+	if dep != nil {
+		return VerifyHash(dl.gopath, dep)
+	}
 	return nil
 }
 
@@ -212,14 +251,19 @@ type DependencySaver struct {
 	// NoRecur contains a list of directories this will not recur
 	// into under root.
 	NoRecur StringSet
+	// Fetch, if set, is used to fetch packages not found on disk.
+	Fetch RepoResolver
+	// Pinned are the existing deps of root, missing packages in
+	// their repos are fetched at their Revision and SourcePath.
+	Pinned []*CanticleDependency
 }
 
 // NewDependencySaver builds a new dependencysaver to work in the
 // specified gopath and resolve using the resolverfunc. A
 // DependencySaver should generally only be used once. A
 // DependencySaver will not attempt to load remote dependencies even
-// if the resolverfunc can handle them. Deps that resolve using ignore
-// will not be saved.
+// if the resolverfunc can handle them unless Fetch is set. Deps that
+// resolve using ignore will not be saved.
 func NewDependencySaver(reader DepReaderFunc, gopath, root string) *DependencySaver {
 	return &DependencySaver{
 		deps:    NewDependencies(),
@@ -241,6 +285,11 @@ func (ds *DependencySaver) SavePackageDeps(path string) error {
 
 	// Check if we can find this package
 	s, err := os.Stat(path)
+	if os.IsNotExist(err) && ds.Fetch != nil {
+		if err = ds.fetchPackage(pkg); err == nil {
+			s, err = os.Stat(path)
+		}
+	}
 	switch {
 	case s != nil && !s.IsDir():
 		err = fmt.Errorf("cant save deps for path %s is a file not a directory", path)
@@ -257,7 +306,7 @@ func (ds *DependencySaver) SavePackageDeps(path string) error {
 		return ErrorSkip
 	}
 	// Don't attempt to read the dependencies of the "src" dir...
-	if path == PackageSource(ds.gopath, "") {
+	if pkg == "" {
 		return nil
 	}
 
@@ -287,12 +336,45 @@ func (ds *DependencySaver) SavePackageDeps(path string) error {
 	ds.deps.AddDependencies(pkgDeps)
 	for _, pkgDep := range pkgDeps {
 		dep.Imports.Add(pkgDep.ImportPath)
+		if pkgDep.Scope == ScopeTest {
+			dep.TestImports.Add(pkgDep.ImportPath)
+		}
+		if pkgDep.Platforms.Size() > 0 {
+			platforms := NewStringSet()
+			platforms.Union(pkgDep.Platforms)
+			dep.ImportPlatforms[pkgDep.ImportPath] = platforms
+		}
 	}
 	LogVerbose("Adding dep for pkg %v", dep)
 	ds.deps.AddDependency(dep)
 	return nil
 }
 
+// fetchPackage creates the repo of pkg with the Fetch resolver at
+// its pinned revision and source, or its default revision if it is
+// not pinned.
+func (ds *DependencySaver) fetchPackage(pkg string) error {
+	var cdep *CanticleDependency
+	for _, dep := range ds.Pinned {
+		if PathIsChild(dep.Root, pkg) {
+			cdep = dep
+		}
+	}
+	rev := ""
+	if cdep != nil {
+		rev = cdep.Revision
+	}
+	LogVerbose("Fetching missing package %s at %q", pkg, rev)
+	vcs, err := ds.Fetch.ResolveRepo(pkg, cdep)
+	if err != nil {
+		return fmt.Errorf("cant resolve missing package %s %s", pkg, err.Error())
+	}
+	if err := vcs.Create(rev); err != nil {
+		return fmt.Errorf("cant fetch missing package %s %s", pkg, err.Error())
+	}
+	return nil
+}
+
 // PackagePaths returns d all import paths for a pkg, and all subdirs
 // if the pkg is under the root of the passed to the ds at construction.
 func (ds *DependencySaver) PackagePaths(path string) ([]string, error) {
@@ -180,11 +180,11 @@ func TestDependencyLoader(t *testing.T) {
 	}
 
 	cdeps := []*CanticleDependency{
-		&CanticleDependency{Root: "pkg1"},
+		&CanticleDependency{Root: "pkg1", Revision: "rev1"},
 		&CanticleDependency{Root: "pkg2"},
 	}
-	pkg1vcs := &TestVCS{}
-	pkg2vcs := &TestVCS{}
+	pkg1vcs := &TestVCS{Root: "pkg1"}
+	pkg2vcs := &TestVCS{Root: "pkg2"}
 	tr := &TestResolver{map[string]*TestVCSResolve{
 		"pkg1":       &TestVCSResolve{pkg1vcs, nil},
 		"pkg1/child": &TestVCSResolve{pkg1vcs, nil},
@@ -232,5 +232,76 @@ func TestDependencyLoader(t *testing.T) {
 	if pkg2vcs.Created != 1 {
 		t.Errorf("Expected pkg2vcs to have 1 create: %d", pkg2vcs.Created)
 	}
+	if pkg1vcs.Updated != 1 || pkg1vcs.Rev != "rev1" {
+		t.Errorf("Expected pkg1vcs set once to rev1 got %d %s", pkg1vcs.Updated, pkg1vcs.Rev)
+	}
+	if unpinned := dl.Unpinned(); len(unpinned) != 1 || unpinned[0] != "pkg2" {
+		t.Errorf("Expected pkg2 to be unpinned got %v", unpinned)
+	}
+
+}
+
+// createVCS makes Dir on Create as a fetch would.
+type createVCS struct {
+	*TestVCS
+	Dir string
+}
+
+func (v *createVCS) Create(rev string) error {
+	v.TestVCS.Create(rev)
+	return os.MkdirAll(v.Dir, 0755)
+}
 
+func TestDependencySaverFetch(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	pkg2dir := path.Join(testHome, "src", "pkg2")
+	deps := &TestDependencyReader{
+		map[string]TestDependencyRead{
+			pkg2dir: TestDependencyRead{NewDependencies(), nil},
+		},
+	}
+
+	ds := NewDependencySaver(deps.ReadDependencies, testHome, testHome)
+	if err := ds.SavePackageDeps(pkg2dir); err != ErrorSkip {
+		t.Errorf("Expected missing pkg2 to be skipped got %v", err)
+	}
+	if dep := ds.Dependencies().Dependency("pkg2"); dep == nil || dep.Err == nil {
+		t.Errorf("Expected missing pkg2 to have an error got %+v", dep)
+	}
+
+	pkg2vcs := &createVCS{&TestVCS{Root: "pkg2"}, pkg2dir}
+	ds = NewDependencySaver(deps.ReadDependencies, testHome, testHome)
+	ds.Fetch = &TestResolver{map[string]*TestVCSResolve{
+		"pkg2": &TestVCSResolve{pkg2vcs, nil},
+	}}
+	if err := ds.SavePackageDeps(pkg2dir); err != nil {
+		t.Errorf("Error saving fetched pkg2: %s", err.Error())
+	}
+	if pkg2vcs.Created != 1 || pkg2vcs.Rev != "" {
+		t.Errorf("Expected pkg2 created once at its default revision got %d %s", pkg2vcs.Created, pkg2vcs.Rev)
+	}
+	if dep := ds.Dependencies().Dependency("pkg2"); dep == nil || dep.Err != nil {
+		t.Errorf("Expected fetched pkg2 saved got %+v", dep)
+	}
+
+	os.RemoveAll(pkg2dir)
+	pinned := &CanticleDependency{Root: "pkg2", Revision: "v1.0.0", SourcePath: "git@test.com:pkg2"}
+	pkg2vcs = &createVCS{&TestVCS{Root: "pkg2"}, pkg2dir}
+	tr := &testResolver{response: []resolve{{pkg2vcs, nil}}}
+	ds = NewDependencySaver(deps.ReadDependencies, testHome, testHome)
+	ds.Fetch = tr
+	ds.Pinned = []*CanticleDependency{{Root: "pkg1", Revision: "abc"}, pinned}
+	if err := ds.SavePackageDeps(pkg2dir); err != nil {
+		t.Errorf("Error saving fetched pkg2: %s", err.Error())
+	}
+	if len(tr.resolutions) != 1 || tr.resolutions[0].dep != pinned {
+		t.Errorf("Expected pkg2 resolved with its pin got %+v", tr.resolutions)
+	}
+	if pkg2vcs.Created != 1 || pkg2vcs.Rev != pinned.Revision {
+		t.Errorf("Expected pkg2 created once at its pinned revision got %d %s", pkg2vcs.Created, pkg2vcs.Rev)
+	}
 }
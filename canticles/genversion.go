@@ -7,9 +7,10 @@ import (
 )
 
 type GenVersion struct {
-	flags   *flag.FlagSet
-	Verbose bool
-	Stable  bool
+	flags     *flag.FlagSet
+	Verbose   bool
+	Stable    bool
+	Resolvers ResolverFlags
 }
 
 func NewGenVersion() *GenVersion {
@@ -19,6 +20,7 @@ func NewGenVersion() *GenVersion {
 	}
 	f.BoolVar(&v.Verbose, "v", false, "Be verbose when getting stuff")
 	f.BoolVar(&v.Stable, "stable", false, "When true, not generate date or host build info so builds can be stable")
+	v.Resolvers.Register(f, "local")
 	return v
 }
 
@@ -30,7 +32,9 @@ var GenVersionCommand = &Command{
 	ShortDescription: "Generate a version go package containing revision of all current dependencies.",
 	LongDescription: `The genversion command will generate a package containing all deps from the current path for use in reporting version information in built applications.
 
-Specify -v to print out a verbose set of operations instead of just errors.`,
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -resolvers to control how the repos of dependencies are found. The default is local and may be changed with $CANTICLE_GENVERSION_RESOLVERS.`,
 	Flags: genversion.flags,
 	Cmd:   genversion,
 }
@@ -56,6 +60,7 @@ func (g *GenVersion) SaveProjectDeps(path string) error {
 	}
 	s := NewSave()
 	s.Resolver = &PreferLocalResolution{}
+	s.Resolvers = g.Resolvers
 	deps, err := s.ReadDeps(gopath, path)
 	if err != nil {
 		return err
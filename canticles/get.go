@@ -5,23 +5,35 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 )
 
 type Get struct {
-	flags   *flag.FlagSet
-	Verbose bool
-	Update  bool
-	Source  string
-	Limit   int
+	flags     *flag.FlagSet
+	Verbose   bool
+	Update    bool
+	Source    string
+	Dest      string
+	Limit     int
+	Scopes    ScopeFlags
+	Resolvers ResolverFlags
+	Recursive bool
+	Resolve   string
 }
 
 func NewGet() *Get {
 	f := flag.NewFlagSet("get", flag.ExitOnError)
-	g := &Get{flags: f}
+	g := &Get{flags: f, Scopes: ScopeFlags(NewStringSet())}
 	f.BoolVar(&g.Verbose, "v", false, "Be verbose when getting stuff")
 	f.BoolVar(&g.Update, "u", false, "Update branches where possible, print the results")
 	f.StringVar(&g.Source, "source", "", "Overide the VCS url to fetch this from")
+	f.StringVar(&g.Dest, "o", "", "Fetch into this GOPATH, using the current GOPATH as a cache")
 	f.IntVar(&g.Limit, "limit", 10, "Limit the number of fetches in flight at once to limit")
+	f.Var(g.Scopes, "scope", "Only fetch dependencies in these comma seperated scopes (runtime, test, tool)")
+	f.BoolVar(&g.Recursive, "r", false, "Also fetch the dependencies in the Canticle files of dependencies")
+	f.StringVar(&g.Resolve, "resolve", "prompt", "With -r resolve conflicts by prompt, ondisk, newest, fail or authority=<Canticle file>")
+	g.Resolvers.Register(f, "local,remote,default")
 	return g
 }
 
@@ -29,13 +41,36 @@ var get = NewGet()
 
 var GetCommand = &Command{
 	Name:             "get",
-	UsageLine:        "get [-v] [-u] [-source] [-limit <n>]",
+	UsageLine:        "get [-v] [-u] [-source] [-o <dir>] [-limit <n>] [-scope <scopes>] [-r] [-resolve <resolution>] [-resolvers <list>] [-no-cache] [-refresh-cache] [-cache-ttl <duration>]",
 	ShortDescription: "download dependencies as defined in the Canticle file",
 	LongDescription: `The get command fetches dependencies. When issued locally it looks...
 
+Dependencies are fetched at the revisions in the Canticle.lock, or if there is no lock those in the Canticle file. Use update to resolve the Canticle file into a new lock. Locked dependencies with a Hash fail to get if the tree checked out does not match it. A Revision may be a version constraint such as ^1.4, ~2.0.3 or >=1.2 <2, the highest matching tag is checked out.
+
+A dependency may require its revision be signed with a Signature policy such as {"Require": "tag", "Keyring": "keys/release.gpg"} or {"Require": "commit", "AllowedSigners": "keys/allowed_signers"}. Require is commit, the checked out commit must be signed, or tag, the revision must be a signed tag. Keyring is an exported GPG public keyring and AllowedSigners an SSH allowed signers file, relative to the Canticle file, only their keys are trusted. Getting a revision without a trusted signature fails. Signatures may only be verified for git.
+
+Repos on disk with uncommitted changes or untracked files are not checked out at another revision or updated, get fails listing every affected repo. Use cant -dirty stash or cant -dirty force to stash the changes first or change the revision anyway.
+
 Specify -v to print out a verbose set of operations instead of just errors.
 
-Specify -u to update branches and print results.`,
+Specify -u to update branches and print results. Locked dependencies are checked out and updated on the branch they were locked from instead of at their locked revision.
+
+Specify -o <dir> to fetch into the GOPATH dir instead of the current GOPATH, for example to build a Docker context. The package itself is copied into dir first. Repos in the current GOPATH are copied from there, with their VCS metadata but without uncommitted changes or untracked files, instead of fetched from the network and revisions already in them checked out without updating, so keep them up to date. Only repos not found there are fetched with the remote resolvers.
+
+Specify -scope to only fetch dependencies in the comma seperated scopes given, for example -scope runtime for production builds. Scopes are runtime, test and tool, dependencies without a scope are runtime. By default all scopes are fetched.
+
+Specify -r to fetch recursively. The Canticle.lock, or Canticle file, of each dependency fetched is read and its runtime dependencies fetched too, until no new dependencies or revisions are wanted. Dependencies in the Canticle files of the package being fetched are never overridden. Where dependencies want different revisions or sources of another the conflict is resolved with -resolve, as with save, and it is fetched again if its resolution changed. Then the go imports of the package and of every package it imports are walked, as vendor does, and those still not on disk fetched at their default branch with a warning.
+
+Specify -resolvers to control how repos are found, as a comma
+separated list of local, remote (guess from the source url), default
+(go get discovery), mirror=<url with {root}>,
+archive=<tar.gz url with {root} and optionally {rev}> and
+cache=<GOPATH to copy from>. The default is
+local,remote,default and may be changed with $CANTICLE_GET_RESOLVERS.
+
+Specify -no-cache to not use the repo root cache, -refresh-cache to
+resolve repo roots against the network and update the cache, and
+-cache-ttl to control how long cached repo roots are trusted.`,
 	Flags: get.flags,
 	Cmd:   get,
 }
@@ -73,25 +108,47 @@ func (g *Get) GetPackage(path string) error {
 	if err != nil {
 		return err
 	}
-	resolvers := []RepoResolver{
-		&LocalRepoResolver{LocalPath: gopath},
-		&RemoteRepoResolver{gopath},
-		&DefaultRepoResolver{gopath},
+	var resolver RepoResolver
+	if g.Dest != "" {
+		cache := gopath
+		if gopath, err = DestGoPath(cache, g.Dest); err != nil {
+			return err
+		}
+		if resolver, err = g.Resolvers.CacheResolver(gopath, cache); err != nil {
+			return err
+		}
+		if path, err = FetchInto(resolver, cache, gopath, path); err != nil {
+			return err
+		}
+	} else if resolver, err = g.Resolvers.Resolver(gopath); err != nil {
+		return err
+	}
+	depReader := &DepReader{Gopath: gopath, Scopes: StringSet(g.Scopes)}
+	conflicts, err := NewConflictResolver(g.Resolve, gopath)
+	if err != nil {
+		return err
 	}
-	resolver := NewMemoizedRepoResolver(&CompositeRepoResolver{resolvers})
-	depReader := &DepReader{gopath}
 
 	loader := &CanticleDepLoader{
-		Reader:   depReader,
-		Resolver: resolver,
-		Gopath:   gopath,
-		Update:   g.Update,
-		Limit:    g.Limit,
+		Reader:    depReader,
+		Resolver:  resolver,
+		Gopath:    gopath,
+		Update:    g.Update,
+		Limit:     g.Limit,
+		Scopes:    StringSet(g.Scopes),
+		Recursive: g.Recursive,
+		Conflicts: conflicts,
+		Imports:   depReader.AllDeps,
 	}
 	if errs := loader.FetchPath(path); len(errs) > 0 {
-		for _, err := range errs {
-			return fmt.Errorf("cant load package %s", err.Error())
+		if len(errs) == 1 {
+			return fmt.Errorf("cant load package %s", errs[0].Error())
 		}
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return fmt.Errorf("cant load package, %d repos failed:\n\t%s", len(errs), strings.Join(msgs, "\n\t"))
 	}
 	if g.Update {
 		b, err := json.Marshal(loader.Updated())
@@ -102,3 +159,26 @@ func (g *Get) GetPackage(path string) error {
 	}
 	return nil
 }
+
+// FetchInto clones the repo of path, a directory in the GOPATH
+// cache, into the GOPATH dest with resolver if it is not already
+// there. It returns the package directory in dest.
+func FetchInto(resolver RepoResolver, cache, dest, path string) (string, error) {
+	pkg, err := PackageName(cache, path)
+	if err != nil {
+		return "", err
+	}
+	destPath := PackageSource(dest, pkg)
+	if _, err := os.Stat(destPath); err == nil {
+		return destPath, nil
+	}
+	LogVerbose("Fetching %s into %s", pkg, dest)
+	v, err := resolver.ResolveRepo(pkg, nil)
+	if err != nil {
+		return "", fmt.Errorf("cant fetch %s into %s %s", pkg, dest, err.Error())
+	}
+	if err := v.Create(""); err != nil {
+		return "", fmt.Errorf("cant fetch %s into %s %s", pkg, dest, err.Error())
+	}
+	return destPath, nil
+}
@@ -0,0 +1,294 @@
+package canticles
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HashPrefix is prepended to the hex sha256 returned by HashTree so
+// the algorithm can be changed later.
+const HashPrefix = "sha256:"
+
+// VCSDirs are the metadata directories of the supported VCSs, they
+// are never hashed.
+var VCSDirs = map[string]bool{".git": true, ".hg": true, ".bzr": true, ".svn": true}
+
+// ExportFuncs write the tree committed at rev, or the checked out
+// revision if rev is empty, of the repo whose metadata directory is
+// the key to dest. The content is exported as committed, without
+// line ending or other filters applied.
+var ExportFuncs = map[string]func(dir, rev, dest string) error{
+	".git": GitExport,
+	".hg":  HgExport,
+	".bzr": BzrExport,
+	".svn": SvnExport,
+}
+
+// GitExport writes the blobs of rev to dest. Blobs are read with git
+// cat-file as git archive and checkout apply eol and filter
+// attributes. Submodules are not exported.
+func GitExport(dir, rev, dest string) error {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	entries, err := nulSeparated(dir, "git", "ls-tree", "-r", "-z", "--full-tree", rev)
+	if err != nil {
+		return err
+	}
+	type blob struct{ mode, sha, path string }
+	var blobs []blob
+	var shas []string
+	for _, entry := range entries {
+		// <mode> SP <type> SP <object> TAB <file>
+		tab := strings.Index(entry, "\t")
+		if tab < 0 {
+			return fmt.Errorf("cant parse git ls-tree entry %q", entry)
+		}
+		fields := strings.Fields(entry[:tab])
+		if len(fields) != 3 {
+			return fmt.Errorf("cant parse git ls-tree entry %q", entry)
+		}
+		if fields[1] != "blob" {
+			continue
+		}
+		blobs = append(blobs, blob{fields[0], fields[2], entry[tab+1:]})
+		shas = append(shas, fields[2])
+	}
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(strings.Join(shas, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("git cat-file --batch failed %s", err.Error())
+	}
+	r := bufio.NewReader(bytes.NewReader(out))
+	for _, b := range blobs {
+		// <object> SP blob SP <size> LF <contents> LF
+		var sha, kind string
+		var size int64
+		if _, err := fmt.Fscanf(r, "%s %s %d\n", &sha, &kind, &size); err != nil || sha != b.sha {
+			return fmt.Errorf("cant read blob %s of %s from git cat-file", b.sha, b.path)
+		}
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return fmt.Errorf("cant read blob %s of %s from git cat-file %s", b.sha, b.path, err.Error())
+		}
+		if err := writeExported(filepath.Join(dest, filepath.FromSlash(b.path)), b.mode, content[:size]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeExported writes content to path as a file, an executable for
+// mode 100755 or a symlink for mode 120000.
+func writeExported(path, mode string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	switch mode {
+	case "120000":
+		return os.Symlink(string(content), path)
+	case "100755":
+		return ioutil.WriteFile(path, content, 0755)
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// HgExport, BzrExport and SvnExport export rev with the VCS, hg
+// without its decode filters and archive metadata and svn without
+// keyword expansion.
+func HgExport(dir, rev, dest string) error {
+	if rev == "" {
+		rev = "."
+	}
+	_, err := outputLines(dir, "hg", "--config", "ui.archivemeta=false", "archive", "--no-decode", "-t", "files", "-r", rev, dest)
+	return err
+}
+
+func BzrExport(dir, rev, dest string) error {
+	args := []string{"export"}
+	if rev != "" {
+		args = append(args, "-r", rev)
+	}
+	_, err := outputLines(dir, "bzr", append(args, dest)...)
+	return err
+}
+
+func SvnExport(dir, rev, dest string) error {
+	if rev == "" {
+		rev = "BASE"
+	}
+	_, err := outputLines(dir, "svn", "export", "--ignore-keywords", "-r", rev, ".", dest)
+	return err
+}
+
+// nulSeparated runs name in dir and returns its NUL separated
+// output.
+func nulSeparated(dir, name string, args ...string) ([]string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	result, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed %s", name, strings.Join(args, " "), err.Error())
+	}
+	var files []string
+	for _, file := range strings.Split(string(result), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// HashTree returns a deterministic hash of the tree committed at rev,
+// or the checked out revision if rev is empty, of the repo at dir.
+// Only committed content is hashed, so uncommitted edits, untracked
+// and ignored files and checkout filters such as core.autocrlf do not
+// change it. If dir is not a repo, for example an archive, the files
+// on disk are hashed instead, except nested repos, which an export of
+// the commit it came from hashes the same as. It is an error if dir
+// is a repo but its revision can not be exported. Each file
+// contributes its slash separated path, whether it is executable or
+// a symlink, and the sha256 of its content (or link target).
+func HashTree(dir, rev string) (string, error) {
+	var export func(dir, rev, dest string) error
+	for name, f := range ExportFuncs {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			export = f
+		}
+	}
+	if export == nil {
+		return hashFiles(dir)
+	}
+	tmp, err := ioutil.TempDir("", "cant-hash")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	tree := filepath.Join(tmp, "tree")
+	if err := export(dir, rev, tree); err != nil {
+		return "", fmt.Errorf("cant export %q of %s to hash %s", rev, dir, err.Error())
+	}
+	// An empty tree exports nothing
+	if err := os.MkdirAll(tree, 0755); err != nil {
+		return "", err
+	}
+	return hashFiles(tree)
+}
+
+// hashFiles hashes the files under dir, see HashTree.
+func hashFiles(dir string) (string, error) {
+	files, err := walkFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, rel := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		f, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		kind, sum, err := hashFile(path, f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %x %s\n", kind, sum, rel)
+	}
+	return fmt.Sprintf("%s%x", HashPrefix, h.Sum(nil)), nil
+}
+
+// walkFiles returns every file under dir except VCS metadata and
+// nested repos, as slash separated paths in walk order.
+func walkFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			if VCSDirs[f.Name()] || (path != dir && isRepoRoot(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// isRepoRoot returns true if dir contains VCS metadata.
+func isRepoRoot(dir string) bool {
+	for name := range VCSDirs {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFile returns the kind of file (f, x for executable or l for a
+// symlink) and the sha256 of its content.
+func hashFile(path string, f os.FileInfo) (string, []byte, error) {
+	h := sha256.New()
+	switch {
+	case f.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", nil, err
+		}
+		io.WriteString(h, filepath.ToSlash(target))
+		return "l", h.Sum(nil), nil
+	case !f.Mode().IsRegular():
+		return "", nil, fmt.Errorf("cant hash %s, not a regular file", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", nil, err
+	}
+	kind := "f"
+	if f.Mode()&0111 != 0 {
+		kind = "x"
+	}
+	return kind, h.Sum(nil), nil
+}
+
+// VerifyHash recomputes the hash of cdep's tree in gopath and returns
+// an error if it does not match cdep.Hash. Deps without a Hash are
+// not verified.
+func VerifyHash(gopath string, cdep *CanticleDependency) error {
+	if cdep.Hash == "" {
+		return nil
+	}
+	if !strings.HasPrefix(cdep.Hash, HashPrefix) {
+		return fmt.Errorf("cant verify %s unknown hash %s", cdep.Root, cdep.Hash)
+	}
+	// Hash the revision checked out, get checks out cdep.Revision
+	hash, err := HashTree(PackageSource(gopath, cdep.Root), "")
+	if err != nil {
+		return fmt.Errorf("cant hash %s %s", cdep.Root, err.Error())
+	}
+	if hash != cdep.Hash {
+		return fmt.Errorf("cant verify %s at %s, tree hash %s does not match locked hash %s", cdep.Root, cdep.Revision, hash, cdep.Hash)
+	}
+	LogVerbose("Verified %s hash %s", cdep.Root, hash)
+	return nil
+}
@@ -0,0 +1,141 @@
+package canticles
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestHashTree(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-hash")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	dir := PackageSource(gopath, "test.com/a")
+	write := func(name, content string, mode os.FileMode) {
+		p := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatalf("Error creating dir %s", err.Error())
+		}
+		if err := ioutil.WriteFile(p, []byte(content), mode); err != nil {
+			t.Fatalf("Error writing file %s", err.Error())
+		}
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatalf("Error chmoding file %s", err.Error())
+		}
+	}
+	hash := func() string {
+		h, err := HashTree(dir, "")
+		if err != nil {
+			t.Fatalf("HashTree returned error %s", err.Error())
+		}
+		return h
+	}
+
+	write("a.go", "package a", 0644)
+	write("sub/b.go", "package b", 0644)
+	original := hash()
+	if original != hash() {
+		t.Errorf("HashTree not deterministic")
+	}
+
+	write("nested/.hg/store", "x", 0644)
+	write("nested/c.go", "package c", 0644)
+	write("other/.git/HEAD", "ref: refs/heads/master", 0644)
+	if h := hash(); h != original {
+		t.Errorf("HashTree included nested repos %s != %s", h, original)
+	}
+
+	write("sub/b.go", "package b ", 0644)
+	changed := hash()
+	if changed == original {
+		t.Errorf("HashTree did not change with content")
+	}
+	write("sub/b.go", "package b ", 0755)
+	if hash() == changed {
+		t.Errorf("HashTree did not change with executable bit")
+	}
+
+	cdep := &CanticleDependency{Root: "test.com/a", Hash: hash()}
+	if err := VerifyHash(gopath, cdep); err != nil {
+		t.Errorf("VerifyHash returned error for matching hash %s", err.Error())
+	}
+	cdep.Hash = original
+	if err := VerifyHash(gopath, cdep); err == nil {
+		t.Errorf("VerifyHash returned no error for mismatched hash")
+	}
+}
+
+func TestHashTreeCommitted(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-hash")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	tr := newTestGitRepo(t, gopath, "test.com/a")
+	tr.write(".gitignore", "build/\n")
+	tr.write("a.go", "package a\n")
+	tr.write("a/b/c.go", "package c\n")
+	tr.write("a.b/d.go", "package d\n")
+	tr.git("add", ".")
+	tr.git("commit", "-q", "-m", "init")
+	first := tr.git("rev-parse", "HEAD")
+	committed, err := HashTree(tr.dir, "")
+	if err != nil {
+		t.Fatalf("HashTree returned error %s", err.Error())
+	}
+
+	// An export of the committed files, as in an archive, hashes the same
+	export := PackageSource(gopath, "test.com/export")
+	for _, file := range []string{".gitignore", "a.go", "a/b/c.go", "a.b/d.go"} {
+		b, err := ioutil.ReadFile(path.Join(tr.dir, file))
+		if err != nil {
+			t.Fatalf("Error reading file %s", err.Error())
+		}
+		if err := os.MkdirAll(path.Dir(path.Join(export, file)), 0755); err != nil {
+			t.Fatalf("Error creating dir %s", err.Error())
+		}
+		if err := ioutil.WriteFile(path.Join(export, file), b, 0644); err != nil {
+			t.Fatalf("Error writing file %s", err.Error())
+		}
+	}
+	if h, err := HashTree(export, ""); err != nil || h != committed {
+		t.Errorf("HashTree of export expected %s got %s %v", committed, h, err)
+	}
+
+	tr.write("build/a.out", "binary")
+	tr.write(".DS_Store", "junk")
+	tr.write("a.go", "package a // edited\n")
+	if h, err := HashTree(tr.dir, first); err != nil || h != committed {
+		t.Errorf("HashTree included uncommitted changes %s != %s %v", h, committed, err)
+	}
+	// Checkout filters do not change the hash
+	os.Remove(path.Join(tr.dir, "a.go"))
+	tr.git("-c", "core.autocrlf=true", "checkout", "--", "a.go")
+	if b, _ := ioutil.ReadFile(path.Join(tr.dir, "a.go")); string(b) != "package a\r\n" {
+		t.Fatalf("Expected a.go checked out with CRLF got %q", string(b))
+	}
+	if h, err := HashTree(tr.dir, ""); err != nil || h != committed {
+		t.Errorf("HashTree changed with checkout filters %s != %s %v", h, committed, err)
+	}
+
+	tr.commit("a.go", "package a // edited\n")
+	if h, err := HashTree(tr.dir, ""); err != nil || h == committed {
+		t.Errorf("HashTree did not change with committed content %v", err)
+	}
+	if h, err := HashTree(tr.dir, first); err != nil || h != committed {
+		t.Errorf("HashTree of %s expected %s got %s %v", first, committed, h, err)
+	}
+	if _, err := HashTree(tr.dir, "nothere"); err == nil {
+		t.Errorf("HashTree returned no error for an unknown revision")
+	}
+	// A repo whose VCS fails is not hashed as plain files
+	if err := os.MkdirAll(path.Join(export, ".git"), 0755); err != nil {
+		t.Fatalf("Error creating dir %s", err.Error())
+	}
+	if h, err := HashTree(export, ""); err == nil {
+		t.Errorf("HashTree returned %s for a broken repo", h)
+	}
+}
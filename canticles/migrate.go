@@ -0,0 +1,84 @@
+package canticles
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+type Migrate struct {
+	flags   *flag.FlagSet
+	Verbose bool
+	DryRun  bool
+}
+
+func NewMigrate() *Migrate {
+	f := flag.NewFlagSet("migrate", flag.ExitOnError)
+	m := &Migrate{flags: f}
+	f.BoolVar(&m.Verbose, "v", false, "Be verbose when migrating")
+	f.BoolVar(&m.DryRun, "d", false, "Don't write the migrated files, just print them.")
+	return m
+}
+
+var migrate = NewMigrate()
+
+var MigrateCommand = &Command{
+	Name:             "migrate",
+	UsageLine:        "migrate [-v] [-d] [dir...]",
+	ShortDescription: "Upgrade Canticle files to the current format.",
+	LongDescription: fmt.Sprintf(`The migrate command rewrites the Canticle files in the given directories, or the current directory, in the current file format (version %d). Legacy files, a bare array of dependencies, are upgraded to a versioned object. Files already in the current format are left alone.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -d to print the migrated files instead of writing them.`, CanticleFormatVersion),
+	Flags: migrate.flags,
+	Cmd:   migrate,
+}
+
+// Run the migrate command.
+func (m *Migrate) Run(args []string) {
+	if m.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	gopath, err := EnvGoPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, dir := range ParseCmdLinePackages(m.flags.Args()) {
+		if err := m.MigrateFile(gopath, dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// MigrateFile upgrades the Canticle file in dir to the current
+// format version.
+func (m *Migrate) MigrateFile(gopath, dir string) error {
+	path := DependencyFile(dir)
+	cf, err := LoadCanticleFile(path)
+	if err != nil {
+		return err
+	}
+	if cf.Version == CanticleFormatVersion && !m.DryRun {
+		LogInfo("%s is already format version %d", path, cf.Version)
+		return nil
+	}
+	if cf.Package == "" {
+		if pkg, err := PackageName(gopath, dir); err == nil {
+			cf.Package = pkg
+		}
+	}
+	if m.DryRun {
+		b, err := cf.Marshal()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stdout, string(b))
+		return nil
+	}
+	LogInfo("Migrating %s from format version %d to %d", path, cf.Version, CanticleFormatVersion)
+	return WriteCanticleFile(path, cf)
+}
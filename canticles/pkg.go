@@ -20,9 +20,11 @@ func (pe PackageError) Error() string {
 }
 
 // IsNoBuildable returns true if this error was caused by a lack of
-// buildable source files.
+// buildable source files, including all files being excluded by
+// build constraints.
 func (pe PackageError) IsNoBuildable() bool {
-	return strings.HasPrefix(pe.Err, "no buildable Go")
+	return strings.HasPrefix(pe.Err, "no buildable Go") ||
+		strings.HasPrefix(pe.Err, "build constraints exclude all Go files")
 }
 
 // A Package describes a go single package found in a directory.  This
@@ -120,9 +122,25 @@ func filterStrings(strings []string, f func(string) bool) []string {
 // will be nil if an error occurs. Package itself may also have
 // errors.
 func LoadPackage(pkgPath, gohome string) (*Package, error) {
-	cmd := exec.Command("go", "list", "--json", "-e", pkgPath)
-	LogVerbose("Running command go list --json -e %s", pkgPath)
-	cmd.Env = PatchEnviroment(os.Environ(), "GOPATH", gohome)
+	return LoadPackageContext(pkgPath, gohome, nil)
+}
+
+// LoadPackageContext works like LoadPackage but lists the package
+// under the GOOS, GOARCH and tags of ctx. If ctx is nil the default
+// build context is used.
+func LoadPackageContext(pkgPath, gohome string, ctx *BuildContext) (*Package, error) {
+	args := []string{"list", "--json", "-e"}
+	env := PatchEnviroment(os.Environ(), "GOPATH", gohome)
+	if ctx != nil {
+		env = ctx.Env(env)
+		if len(ctx.Tags) > 0 {
+			args = append(args, "-tags", strings.Join(ctx.Tags, ","))
+		}
+	}
+	args = append(args, pkgPath)
+	cmd := exec.Command("go", args...)
+	LogVerbose("Running command go %s", strings.Join(args, " "))
+	cmd.Env = env
 	result, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, errors.New(string(result))
@@ -150,3 +168,12 @@ func (p *Package) RemoteImports(includeTest bool) []string {
 
 	return filterStrings(imports, IsRemote)
 }
+
+// RemoteTestImports returns the remote imports of the packages test
+// and external test files, excluding the package itself.
+func (p *Package) RemoteTestImports() []string {
+	imports := append(append([]string{}, p.TestImports...), p.XTestImports...)
+	return filterStrings(imports, func(imp string) bool {
+		return imp != p.ImportPath && IsRemote(imp)
+	})
+}
@@ -0,0 +1,81 @@
+package canticles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A BuildContext is a GOOS, GOARCH and set of build tags under which
+// the imports of a package are read.
+type BuildContext struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+// ParseBuildContext parses a context of the form
+// goos/goarch[:tag,tag...], e.g. windows/amd64 or linux/arm:integration.
+func ParseBuildContext(s string) (*BuildContext, error) {
+	platform, tags := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		platform, tags = s[:i], s[i+1:]
+	}
+	parts := strings.Split(platform, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("platform %q is not of the form goos/goarch[:tag,tag]", s)
+	}
+	bc := &BuildContext{GOOS: parts[0], GOARCH: parts[1]}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag != "" {
+			bc.Tags = append(bc.Tags, tag)
+		}
+	}
+	return bc, nil
+}
+
+// String returns the context in the form parsed by
+// ParseBuildContext.
+func (bc *BuildContext) String() string {
+	s := bc.GOOS + "/" + bc.GOARCH
+	if len(bc.Tags) > 0 {
+		s += ":" + strings.Join(bc.Tags, ",")
+	}
+	return s
+}
+
+// Env patches env to build for this context.
+func (bc *BuildContext) Env(env []string) []string {
+	env = PatchEnviroment(env, "GOOS", bc.GOOS)
+	return PatchEnviroment(env, "GOARCH", bc.GOARCH)
+}
+
+// BuildContexts is a matrix of contexts to read imports under. It
+// implements flag.Value, each Set adds one or more space separated
+// contexts.
+type BuildContexts []*BuildContext
+
+// String returns the contexts space separated.
+func (bcs BuildContexts) String() string {
+	return strings.Join(bcs.Strings(), " ")
+}
+
+// Strings returns the String of each context.
+func (bcs BuildContexts) Strings() []string {
+	strs := make([]string, 0, len(bcs))
+	for _, bc := range bcs {
+		strs = append(strs, bc.String())
+	}
+	return strs
+}
+
+// Set parses and adds the contexts in v.
+func (bcs *BuildContexts) Set(v string) error {
+	for _, s := range strings.Fields(v) {
+		bc, err := ParseBuildContext(s)
+		if err != nil {
+			return err
+		}
+		*bcs = append(*bcs, bc)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package canticles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBuildContext(t *testing.T) {
+	bc, err := ParseBuildContext("linux/arm:integration,cgo")
+	if err != nil {
+		t.Fatalf("ParseBuildContext returned error for valid context: %s", err.Error())
+	}
+	expected := &BuildContext{GOOS: "linux", GOARCH: "arm", Tags: []string{"integration", "cgo"}}
+	if !reflect.DeepEqual(expected, bc) {
+		t.Errorf("ParseBuildContext returned %+v expected %+v", bc, expected)
+	}
+	if bc.String() != "linux/arm:integration,cgo" {
+		t.Errorf("BuildContext String returned %s", bc.String())
+	}
+	for _, bad := range []string{"linux", "linux/", "/amd64", "linux/amd64/x"} {
+		if _, err := ParseBuildContext(bad); err == nil {
+			t.Errorf("ParseBuildContext returned no error for %s", bad)
+		}
+	}
+
+	var bcs BuildContexts
+	if err := bcs.Set("windows/amd64 darwin/arm64"); err != nil {
+		t.Fatalf("BuildContexts error setting valid contexts: %s", err.Error())
+	}
+	if err := bcs.Set("linux/amd64:integration"); err != nil {
+		t.Fatalf("BuildContexts error setting valid contexts: %s", err.Error())
+	}
+	if bcs.String() != "windows/amd64 darwin/arm64 linux/amd64:integration" {
+		t.Errorf("BuildContexts String returned %s", bcs.String())
+	}
+}
@@ -0,0 +1,278 @@
+package canticles
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Prune struct {
+	flags   *flag.FlagSet
+	Verbose bool
+	DryRun  bool
+	Yes     bool
+}
+
+func NewPrune() *Prune {
+	f := flag.NewFlagSet("prune", flag.ExitOnError)
+	p := &Prune{flags: f}
+	f.BoolVar(&p.Verbose, "v", false, "Be verbose when pruning")
+	f.BoolVar(&p.DryRun, "n", false, "Only list the repos which would be removed")
+	f.BoolVar(&p.Yes, "y", false, "Remove the repos without asking for confirmation")
+	return p
+}
+
+var prune = NewPrune()
+
+var PruneCommand = &Command{
+	Name:             "prune",
+	UsageLine:        "prune [-v] [-n] [-y] [dir...]",
+	ShortDescription: "Remove repos no Canticle file references from the GOPATH.",
+	LongDescription: `The prune command removes the repos in the GOPATH which are not referenced by a Canticle file. Referenced repos are the projects in the given directories and every Root in their Canticle and Canticle.lock files, and in the Canticle files of those Roots, recursively. If no directories are given the Roots in the Canticle files of every project in the GOPATH are referenced, but not the projects themselves unless a Canticle file references them, so stale repos with their own Canticle files are removed. Name your own projects to keep them. Repos only imported by go code and not listed in a Canticle file are not referenced.
+
+The repos to remove are listed and removed after confirmation. Repos with uncommitted changes, untracked files, commits on no remote, including commits only tagged, or stashed or shelved changes, such as those cant -dirty stash makes, are never removed.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -n to only list the repos which would be removed.
+
+Specify -y to remove the repos without asking for confirmation.`,
+	Flags: prune.flags,
+	Cmd:   prune,
+}
+
+// Run the prune command.
+func (p *Prune) Run(args []string) {
+	if p.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	gopath, err := EnvGoPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var named, found []string
+	if len(p.flags.Args()) > 0 {
+		named = ParseCmdLinePackages(p.flags.Args())
+	} else if found, err = CanticleProjects(gopath); err != nil {
+		log.Fatal(err)
+	}
+	referenced, err := ReferencedRoots(gopath, named, found)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stale, err := UnreferencedRepos(gopath, referenced)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var remove []string
+	for _, dir := range stale {
+		if err := CheckRemovable(gopath, dir); err != nil {
+			fmt.Printf("Keeping %s\n", err.Error())
+			continue
+		}
+		remove = append(remove, dir)
+	}
+	if len(remove) == 0 {
+		fmt.Println("Nothing to prune")
+		return
+	}
+	fmt.Printf("%d repos are not referenced by a Canticle file:\n\t%s\n", len(remove), strings.Join(remove, "\n\t"))
+	if p.DryRun {
+		return
+	}
+	if !p.Yes {
+		fmt.Printf("Remove them? [y/N] ")
+		var answer string
+		fmt.Scanln(&answer)
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Nothing removed")
+			return
+		}
+	}
+	for _, dir := range remove {
+		LogVerbose("Removing %s", dir)
+		if err := RemoveRepo(gopath, dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("Removed %d repos\n", len(remove))
+}
+
+// CanticleProjects returns the directories in each entry of gopath
+// with a Canticle or Canticle.lock file.
+func CanticleProjects(gopath string) ([]string, error) {
+	var projects []string
+	for _, entry := range filepath.SplitList(gopath) {
+		err := filepath.Walk(PackageSource(entry, ""), func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !f.IsDir() {
+				return nil
+			}
+			if strings.HasPrefix(f.Name(), ".") {
+				return filepath.SkipDir
+			}
+			for _, file := range []string{DependencyFile(path), LockFile(path)} {
+				if _, err := os.Stat(file); err == nil {
+					projects = append(projects, path)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cant find projects in %s %s", entry, err.Error())
+		}
+	}
+	return projects, nil
+}
+
+// ReferencedRoots returns the packages of the named projects and the
+// Roots in the Canticle and Canticle.lock files of the named and
+// found projects, and in the Canticle files of those Roots,
+// recursively. Found projects are only referenced if a file
+// references them, so stale repos with their own Canticle files are
+// not.
+func ReferencedRoots(gopath string, named, found []string) (StringSet, error) {
+	referenced := NewStringSet()
+	reader := &DepReader{Gopath: gopath}
+	var queue []string
+	for i, project := range append(named, found...) {
+		pkg, err := PackageName(gopath, project)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, pkg)
+		if i < len(named) {
+			referenced.Add(pkg)
+		}
+	}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		intent, err := reader.IntentDependencies(pkg)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cant read Canticle file of %s %s", pkg, err.Error())
+		}
+		locked, err := reader.LockedDependencies(pkg)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cant read Canticle.lock of %s %s", pkg, err.Error())
+		}
+		for _, cdep := range append(intent, locked...) {
+			if !referenced[cdep.Root] {
+				LogVerbose("%s references %s", pkg, cdep.Root)
+				referenced.Add(cdep.Root)
+				queue = append(queue, cdep.Root)
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// UnreferencedRepos returns the directories of the repos in each
+// entry of gopath whose root is not referenced. Repos containing or
+// inside a referenced package are referenced.
+func UnreferencedRepos(gopath string, referenced StringSet) ([]string, error) {
+	var stale []string
+	for _, entry := range filepath.SplitList(gopath) {
+		err := filepath.Walk(PackageSource(entry, ""), func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !f.IsDir() {
+				return nil
+			}
+			if strings.HasPrefix(f.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !isRepoRoot(path) {
+				return nil
+			}
+			root, err := PackageName(entry, path)
+			if err != nil {
+				return err
+			}
+			for ref := range referenced {
+				if PathIsChild(root, ref) || PathIsChild(ref, root) {
+					return filepath.SkipDir
+				}
+			}
+			stale = append(stale, path)
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cant find repos in %s %s", entry, err.Error())
+		}
+	}
+	return stale, nil
+}
+
+// CheckRemovable returns an error if the repo at dir has uncommitted
+// changes, commits on no remote, including those only tagged, or
+// stashed or shelved changes, such as those cant -dirty stash makes,
+// or they can not be checked.
+func CheckRemovable(gopath, dir string) error {
+	entry := GoPathEntry(gopath, dir)
+	pkg, err := PackageName(entry, dir)
+	if err != nil {
+		return err
+	}
+	v, err := (&LocalRepoResolver{LocalPath: entry}).ResolveRepo(pkg, nil)
+	if err != nil {
+		return fmt.Errorf("%s, cant find its vcs %s", dir, err.Error())
+	}
+	lv, ok := v.(*LocalVCS)
+	if !ok {
+		return fmt.Errorf("%s, cant check a %T", dir, v)
+	}
+	changes, err := lv.LocalChanges()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s, %s", dir, err.Error())
+	case len(changes) > 0:
+		return fmt.Errorf("%s, it has %d uncommitted changes", dir, len(changes))
+	}
+	commits, err := lv.LocalCommits()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s, %s", dir, err.Error())
+	case len(commits) > 0:
+		return fmt.Errorf("%s, it has %d commits on no remote", dir, len(commits))
+	}
+	shelved, err := lv.LocalShelved()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s, %s", dir, err.Error())
+	case len(shelved) > 0:
+		return fmt.Errorf("%s, it has %d stashed changes", dir, len(shelved))
+	}
+	return nil
+}
+
+// RemoveRepo removes the repo at dir and any parents of it in its
+// entry of gopath left empty.
+func RemoveRepo(gopath, dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("cant remove %s %s", dir, err.Error())
+	}
+	src := filepath.Clean(PackageSource(GoPathEntry(gopath, dir), ""))
+	for parent := filepath.Dir(dir); parent != src && PathIsChild(src, parent); parent = filepath.Dir(parent) {
+		if err := os.Remove(parent); err != nil {
+			break
+		}
+	}
+	return nil
+}
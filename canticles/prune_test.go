@@ -0,0 +1,107 @@
+package canticles
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-prune")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	repos := make(map[string]*testGitRepo)
+	repo := func(pkg string, deps ...string) {
+		tr := newTestGitRepo(t, gopath, pkg)
+		var cdeps []*CanticleDependency
+		for _, dep := range deps {
+			cdeps = append(cdeps, &CanticleDependency{Root: dep})
+		}
+		if len(cdeps) > 0 {
+			if err := WriteCanticleFile(DependencyFile(tr.dir), NewCanticleFile(pkg, cdeps)); err != nil {
+				t.Fatalf("Error writing Canticle file: %s", err.Error())
+			}
+		} else {
+			tr.write("a.go", "package a")
+		}
+		tr.git("add", ".")
+		tr.git("commit", "-q", "-m", "init")
+		tr.git("update-ref", "refs/remotes/origin/master", "HEAD")
+		repos[pkg] = tr
+	}
+	repo("test.com/app", "test.com/a")
+	repo("test.com/a", "test.com/b")
+	repo("test.com/b")
+	repo("test.com/stale")
+	repo("test.com/stalelib", "test.com/b")
+	repo("test.com/dirty")
+	repo("test.com/local")
+	repo("test.com/stashed")
+	repo("test.com/tagged")
+
+	// Found projects are not referenced by their own Canticle files
+	found, err := CanticleProjects(gopath)
+	if err != nil {
+		t.Fatalf("CanticleProjects returned error %s", err.Error())
+	}
+	referenced, err := ReferencedRoots(gopath, nil, found)
+	if err != nil {
+		t.Fatalf("ReferencedRoots returned error %s", err.Error())
+	}
+	if expected := []string{"test.com/a", "test.com/b"}; !reflect.DeepEqual(referenced.Array(), expected) {
+		t.Errorf("ReferencedRoots of found projects %v expected %v got %v", found, expected, referenced.Array())
+	}
+	referenced, err = ReferencedRoots(gopath, []string{PackageSource(gopath, "test.com/app")}, nil)
+	if err != nil {
+		t.Fatalf("ReferencedRoots returned error %s", err.Error())
+	}
+	if expected := []string{"test.com/a", "test.com/app", "test.com/b"}; !reflect.DeepEqual(referenced.Array(), expected) {
+		t.Errorf("ReferencedRoots expected %v got %v", expected, referenced.Array())
+	}
+	stale, err := UnreferencedRepos(gopath, referenced)
+	if err != nil {
+		t.Fatalf("UnreferencedRepos returned error %s", err.Error())
+	}
+	var expected []string
+	for _, pkg := range []string{"dirty", "local", "stale", "stalelib", "stashed", "tagged"} {
+		expected = append(expected, PackageSource(gopath, "test.com/"+pkg))
+	}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("UnreferencedRepos expected %v got %v", expected, stale)
+	}
+
+	repos["test.com/dirty"].write("new", "new")
+	repos["test.com/local"].commit("local", "local")
+	stashed := repos["test.com/stashed"]
+	stashed.write("a.go", "package a // edited")
+	stashed.write("new", "new")
+	stashed.git("stash", "save", "-q", "--include-untracked", "edits")
+	if status := stashed.git("status", "--porcelain"); status != "" {
+		t.Fatalf("Expected stash to leave a clean tree got %s", status)
+	}
+	tagged := repos["test.com/tagged"]
+	tagged.git("checkout", "-q", "-b", "release")
+	tagged.commit("release", "release")
+	tagged.git("tag", "v1.0.0")
+	tagged.git("checkout", "-q", "master")
+	tagged.git("branch", "-q", "-D", "release")
+	for _, dir := range stale {
+		err := CheckRemovable(gopath, dir)
+		removable := dir == PackageSource(gopath, "test.com/stale") || dir == PackageSource(gopath, "test.com/stalelib")
+		if removable != (err == nil) {
+			t.Errorf("CheckRemovable of %s returned %v", dir, err)
+		}
+	}
+	if err := RemoveRepo(gopath, PackageSource(gopath, "test.com/stale")); err != nil {
+		t.Fatalf("RemoveRepo returned error %s", err.Error())
+	}
+	if _, err := os.Stat(PackageSource(gopath, "test.com/stale")); !os.IsNotExist(err) {
+		t.Errorf("RemoveRepo did not remove repo %v", err)
+	}
+	if _, err := os.Stat(PackageSource(gopath, "test.com")); err != nil {
+		t.Errorf("RemoveRepo removed non empty parent %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package canticles
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// DefaultRepoCacheTTL is how long a cached repo root resolution is
+// trusted before it is resolved against the network again.
+var DefaultRepoCacheTTL = 7 * 24 * time.Hour
+
+// RepoCacheEntry is a single persisted resolution of an import path
+// to a repo root.
+type RepoCacheEntry struct {
+	// Source is the SourcePath of the CanticleDependency used to
+	// resolve this entry, if any.
+	Source string `json:",omitempty"`
+	// Root is the import path of the repo root.
+	Root string
+	// Repo is the url the repo will be fetched from.
+	Repo string
+	// VCS is the command (git, hg, etc.) of the repos vcs.
+	VCS string
+	// Resolved is when this entry was resolved.
+	Resolved time.Time
+}
+
+// A RepoCache persists successful vcs.RepoRoot resolutions to disk
+// so that repeated runs do not require discovery traffic. Entries
+// older than TTL are ignored.
+type RepoCache struct {
+	sync.Mutex
+	Path    string
+	TTL     time.Duration
+	entries map[string]*RepoCacheEntry
+}
+
+// DefaultRepoCachePath returns the location of the users repo cache
+// file.
+func DefaultRepoCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "canticle", "reporoots.json"), nil
+}
+
+// LoadRepoCache reads the repo cache stored at path. A missing file
+// results in an empty cache and no error.
+func LoadRepoCache(path string, ttl time.Duration) (*RepoCache, error) {
+	rc := &RepoCache{
+		Path:    path,
+		TTL:     ttl,
+		entries: make(map[string]*RepoCacheEntry),
+	}
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case err != nil && os.IsNotExist(err):
+		return rc, nil
+	case err != nil:
+		return nil, err
+	}
+	LogVerbose("Reading repo cache: %s", path)
+	if err := json.Unmarshal(b, &rc.entries); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Get returns the cached RepoRoot for importPath resolved with
+// source, nil if it is not present or has expired.
+func (rc *RepoCache) Get(importPath, source string) *vcs.RepoRoot {
+	rc.Lock()
+	entry := rc.entries[importPath]
+	rc.Unlock()
+	if entry == nil || entry.Source != source {
+		return nil
+	}
+	if rc.TTL > 0 && time.Since(entry.Resolved) > rc.TTL {
+		LogVerbose("Repo cache entry for %s expired", importPath)
+		return nil
+	}
+	cmd := vcsByCmd(entry.VCS, entry.Repo)
+	if cmd == nil {
+		return nil
+	}
+	return &vcs.RepoRoot{VCS: cmd, Repo: entry.Repo, Root: entry.Root}
+}
+
+// Put records the resolution of importPath with source to repo and
+// saves the cache to disk.
+func (rc *RepoCache) Put(importPath, source string, repo *vcs.RepoRoot) error {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.entries[importPath] = &RepoCacheEntry{
+		Source:   source,
+		Root:     repo.Root,
+		Repo:     repo.Repo,
+		VCS:      repo.VCS.Cmd,
+		Resolved: time.Now(),
+	}
+	return rc.save()
+}
+
+// save writes the cache to a temporary file and renames it over Path
+// so concurrent cant processes never see a partial file.
+func (rc *RepoCache) save() error {
+	b, err := json.MarshalIndent(rc.entries, "", "    ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(rc.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".reporoots")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), rc.Path)
+}
+
+// vcsByCmd returns the vcs.Cmd for cmd, using the git@ variant for
+// repos using that syntax.
+func vcsByCmd(cmd, repo string) *vcs.Cmd {
+	if cmd == "git" && strings.HasPrefix(repo, "git@") {
+		return GitAtVCS()
+	}
+	return vcs.ByCmd(cmd)
+}
+
+// CachedRepoResolver consults a RepoCache before calling its child
+// Resolver, and stores any PackageVCS the child resolves. If Refresh
+// is true the cache is not read but is still written. Name, if set,
+// namespaces the cache entries so differing resolvers do not share
+// results.
+type CachedRepoResolver struct {
+	Cache    *RepoCache
+	Resolver RepoResolver
+	Gopath   string
+	Refresh  bool
+	Name     string
+}
+
+// ResolveRepo on a CachedRepoResolver returns a PackageVCS from the
+// cache if present, otherwise the result of its child resolver.
+func (cr *CachedRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	source := ""
+	if dep != nil {
+		source = dep.SourcePath
+	}
+	key := importPath
+	if cr.Name != "" {
+		key = cr.Name + "|" + importPath
+	}
+	if !cr.Refresh {
+		if repo := cr.Cache.Get(key, source); repo != nil {
+			LogVerbose("Using cached repo root for %s: %+v", importPath, repo)
+			return &PackageVCS{Repo: repo, Gopath: cr.Gopath}, nil
+		}
+	}
+
+	v, err := cr.Resolver.ResolveRepo(importPath, dep)
+	if err != nil {
+		return v, err
+	}
+	if pv, ok := v.(*PackageVCS); ok {
+		if err := cr.Cache.Put(key, source, pv.Repo); err != nil {
+			LogWarn("Could not save repo cache %s: %s", cr.Cache.Path, err.Error())
+		}
+	}
+	return v, nil
+}
+
+// RepoCacheFlags holds the command line controls for the repo
+// cache shared by commands which resolve remote repos.
+type RepoCacheFlags struct {
+	NoCache bool
+	Refresh bool
+	TTL     time.Duration
+}
+
+// Register adds the repo cache flags to f.
+func (cf *RepoCacheFlags) Register(f *flag.FlagSet) {
+	f.BoolVar(&cf.NoCache, "no-cache", false, "Do not read or write the repo root cache.")
+	f.BoolVar(&cf.Refresh, "refresh-cache", false, "Resolve repo roots against the network and refresh the cache.")
+	f.DurationVar(&cf.TTL, "cache-ttl", DefaultRepoCacheTTL, "Ignore repo root cache entries older than this.")
+}
+
+// Load returns the users RepoCache, or nil if the cache is disabled.
+func (cf *RepoCacheFlags) Load() (*RepoCache, error) {
+	if cf.NoCache {
+		return nil, nil
+	}
+	path, err := DefaultRepoCachePath()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := LoadRepoCache(path, cf.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("cant load repo cache %s %s", path, err.Error())
+	}
+	return cache, nil
+}
@@ -0,0 +1,101 @@
+package canticles
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+func TestRepoCache(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-cache")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	cachePath := path.Join(testHome, "canticle", "reporoots.json")
+
+	rc, err := LoadRepoCache(cachePath, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadRepoCache returned error for missing file: %s", err.Error())
+	}
+	if repo := rc.Get("test.com/test/child", ""); repo != nil {
+		t.Errorf("Empty RepoCache returned repo %+v", repo)
+	}
+
+	repo := &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: "https://test.com/test", Root: "test.com/test"}
+	if err := rc.Put("test.com/test/child", "", repo); err != nil {
+		t.Fatalf("RepoCache error saving entry: %s", err.Error())
+	}
+
+	rc, err = LoadRepoCache(cachePath, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadRepoCache returned error for valid file: %s", err.Error())
+	}
+	cached := rc.Get("test.com/test/child", "")
+	if cached == nil {
+		t.Fatalf("RepoCache did not persist entry")
+	}
+	if cached.Root != repo.Root || cached.Repo != repo.Repo || cached.VCS.Cmd != "git" {
+		t.Errorf("RepoCache returned %+v expected %+v", cached, repo)
+	}
+	if repo := rc.Get("test.com/test/child", "git@test.com:test"); repo != nil {
+		t.Errorf("RepoCache returned entry for different source %+v", repo)
+	}
+
+	rc.TTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if repo := rc.Get("test.com/test/child", ""); repo != nil {
+		t.Errorf("RepoCache returned expired entry %+v", repo)
+	}
+}
+
+func TestCachedRepoResolver(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-cache")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	rc, err := LoadRepoCache(path.Join(testHome, "reporoots.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("LoadRepoCache returned error for missing file: %s", err.Error())
+	}
+
+	res := &PackageVCS{Repo: &vcs.RepoRoot{VCS: vcs.ByCmd("hg"), Repo: "https://test.com/hg", Root: "test.com/hg"}}
+	tr := &testResolver{response: []resolve{{res, nil}}}
+	cr := &CachedRepoResolver{Cache: rc, Resolver: tr, Gopath: testHome}
+	dep := &CanticleDependency{Root: "test.com/hg"}
+
+	v, err := cr.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Fatalf("CachedRepoResolver returned error %s", err.Error())
+	}
+	if v != res {
+		t.Errorf("CachedRepoResolver did not return child vcs on miss")
+	}
+
+	v, err = cr.ResolveRepo(dep.Root, dep)
+	if err != nil {
+		t.Fatalf("CachedRepoResolver returned error %s", err.Error())
+	}
+	if len(tr.resolutions) != 1 {
+		t.Errorf("CachedRepoResolver called child resolver on a cache hit")
+	}
+	pv := v.(*PackageVCS)
+	if pv.Repo.Root != "test.com/hg" || pv.Repo.VCS.Cmd != "hg" || pv.Gopath != testHome {
+		t.Errorf("CachedRepoResolver returned bad cached vcs %+v", pv.Repo)
+	}
+
+	// Refresh should always go to the child
+	tr.response = []resolve{{res, nil}}
+	cr.Refresh = true
+	if _, err := cr.ResolveRepo(dep.Root, dep); err != nil {
+		t.Fatalf("CachedRepoResolver returned error %s", err.Error())
+	}
+	if len(tr.resolutions) != 2 {
+		t.Errorf("CachedRepoResolver did not call child resolver when refreshing")
+	}
+}
@@ -0,0 +1,123 @@
+package canticles
+
+import (
+	"flag"
+	"fmt"
+	"log"
+)
+
+type Resolve struct {
+	flags     *flag.FlagSet
+	Verbose   bool
+	Source    string
+	Resolvers ResolverFlags
+}
+
+func NewResolve() *Resolve {
+	f := flag.NewFlagSet("resolve", flag.ExitOnError)
+	r := &Resolve{flags: f}
+	f.BoolVar(&r.Verbose, "v", false, "Be verbose when resolving stuff")
+	f.StringVar(&r.Source, "source", "", "Resolve using this VCS url as the source")
+	r.Resolvers.Register(f, "local,remote,default")
+	return r
+}
+
+var resolveRepo = NewResolve()
+
+var ResolveCommand = &Command{
+	Name:             "resolve",
+	UsageLine:        "resolve [-v] [-source <url>] [-resolvers <list>] [-no-cache] [-refresh-cache] <importpath>...",
+	ShortDescription: "Print how an import path resolves to a repo root.",
+	LongDescription: `The resolve command attempts to resolve import paths to a repo root using the same resolvers as get, or those given by -resolvers. On success it prints the root, source and vcs. On failure it prints each resolvers attempt, the url tried, vcs pinged and the resulting error.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -source to resolve using a specific VCS url, as if it were the SourcePath in a Canticle file.
+
+Specify -no-cache or -refresh-cache to bypass or refresh the repo root cache.`,
+	Flags: resolveRepo.flags,
+	Cmd:   resolveRepo,
+}
+
+// Run the resolve command. Exits non zero if any path fails to
+// resolve.
+func (r *Resolve) Run(args []string) {
+	if r.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	pkgArgs := r.flags.Args()
+	if len(pkgArgs) == 0 {
+		log.Fatal("cant resolve requires at least one import path")
+	}
+	if r.Source != "" && len(pkgArgs) > 1 {
+		log.Fatal("cant resolve may not be run with -source and multiple import paths")
+	}
+	failed := false
+	for _, pkg := range pkgArgs {
+		if err := r.PrintResolution(pkg); err != nil {
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatal("cant resolve all import paths")
+	}
+}
+
+// PrintResolution resolves importPath and prints the result, or the
+// attempts of each resolver if it could not be resolved.
+func (r *Resolve) PrintResolution(importPath string) error {
+	v, err := r.ResolvePath(importPath)
+	if err != nil {
+		fmt.Printf("%s: could not be resolved\n", importPath)
+		if re := ResolutionFailureErr(err); re != nil && len(re.Attempts) > 0 {
+			for i, attempt := range re.Attempts {
+				fmt.Printf("  %d. %s\n", i+1, attempt.String())
+			}
+		} else {
+			fmt.Printf("  %s\n", err.Error())
+		}
+		return err
+	}
+	source, err := v.GetSource()
+	if err != nil {
+		LogVerbose("Error getting source for %s: %s", importPath, err.Error())
+	}
+	fmt.Printf("%s:\n  root: %s\n  source: %s\n  vcs: %s\n", importPath, v.GetRoot(), source, vcsName(v))
+	return nil
+}
+
+// ResolvePath resolves importPath using the resolvers get would use.
+// If resolution fails the returned error is a ResolutionFailureError
+// containing each resolvers attempt.
+func (r *Resolve) ResolvePath(importPath string) (VCS, error) {
+	gopath, err := EnvGoPath()
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := r.Resolvers.Resolver(gopath)
+	if err != nil {
+		return nil, err
+	}
+	var dep *CanticleDependency
+	if r.Source != "" {
+		dep = &CanticleDependency{Root: importPath, SourcePath: r.Source}
+	}
+	return resolver.ResolveRepo(importPath, dep)
+}
+
+// vcsName returns the name of the vcs used by v if known.
+func vcsName(v VCS) string {
+	switch v := v.(type) {
+	case *LocalVCS:
+		if v.Cmd != nil {
+			return v.Cmd.Name
+		}
+	case *PackageVCS:
+		if v.Repo != nil && v.Repo.VCS != nil {
+			return v.Repo.VCS.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,367 @@
+package canticles
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// A RepoResolverFactory builds a RepoResolver working in gopath from
+// the argument given to it in a ResolverChain.
+type RepoResolverFactory struct {
+	// Remote is true if the resolvers built may touch the
+	// network. Adjacent remote resolvers are cached as a group.
+	Remote bool
+	// New builds the resolver. Arg is the value after "=" in the
+	// chain, or the empty string.
+	New func(gopath, arg string) (RepoResolver, error)
+}
+
+// RepoResolvers is the registry of named RepoResolvers usable in a
+// ResolverChain. Additional resolvers may be registered here before
+// commands are run.
+var RepoResolvers = map[string]*RepoResolverFactory{
+	"local": {
+		New: func(gopath, arg string) (RepoResolver, error) {
+			return &LocalRepoResolver{LocalPath: gopath}, nil
+		},
+	},
+	"cache": {
+		New: func(gopath, arg string) (RepoResolver, error) {
+			return NewCacheRepoResolver(gopath, arg)
+		},
+	},
+	"remote": {
+		Remote: true,
+		New: func(gopath, arg string) (RepoResolver, error) {
+			return &RemoteRepoResolver{gopath}, nil
+		},
+	},
+	"default": {
+		Remote: true,
+		New: func(gopath, arg string) (RepoResolver, error) {
+			return &DefaultRepoResolver{gopath}, nil
+		},
+	},
+	"mirror": {
+		Remote: true,
+		New: func(gopath, arg string) (RepoResolver, error) {
+			return NewMirrorRepoResolver(gopath, arg)
+		},
+	},
+	"archive": {
+		Remote: true,
+		New: func(gopath, arg string) (RepoResolver, error) {
+			return NewArchiveRepoResolver(gopath, arg)
+		},
+	},
+}
+
+// ResolverSpec names a registered RepoResolver and its argument.
+type ResolverSpec struct {
+	Name string
+	Arg  string
+}
+
+// String returns the spec as name or name=arg.
+func (rs ResolverSpec) String() string {
+	if rs.Arg == "" {
+		return rs.Name
+	}
+	return rs.Name + "=" + rs.Arg
+}
+
+// A ResolverChain is a declarative, ordered list of RepoResolvers
+// such as "local,mirror=https://mirror.example.com/{root},default".
+// It implements flag.Value.
+type ResolverChain []ResolverSpec
+
+// ParseResolverChain parses a comma separated list of resolver
+// specs. Each name must be registered in RepoResolvers.
+func ParseResolverChain(chain string) (ResolverChain, error) {
+	var rc ResolverChain
+	for _, part := range strings.Split(chain, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		spec := ResolverSpec{Name: part}
+		if i := strings.Index(part, "="); i >= 0 {
+			spec.Name, spec.Arg = part[:i], part[i+1:]
+		}
+		if RepoResolvers[spec.Name] == nil {
+			return nil, fmt.Errorf("unknown resolver %s, known resolvers are %v", spec.Name, registeredResolvers())
+		}
+		rc = append(rc, spec)
+	}
+	return rc, nil
+}
+
+// String returns the chain in its parseable form.
+func (rc ResolverChain) String() string {
+	specs := make([]string, 0, len(rc))
+	for _, spec := range rc {
+		specs = append(specs, spec.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+// Set replaces the chain with the parsed value of v.
+func (rc *ResolverChain) Set(v string) error {
+	chain, err := ParseResolverChain(v)
+	if err != nil {
+		return err
+	}
+	*rc = chain
+	return nil
+}
+
+// WithCache returns a copy of the chain with cache=<gopath> added
+// before its first remote resolver, so repos already in gopath are
+// copied from there instead of fetched from the network.
+func (rc ResolverChain) WithCache(gopath string) ResolverChain {
+	chain := make(ResolverChain, 0, len(rc)+1)
+	added := false
+	for _, spec := range rc {
+		if !added && RepoResolvers[spec.Name] != nil && RepoResolvers[spec.Name].Remote {
+			chain = append(chain, ResolverSpec{Name: "cache", Arg: gopath})
+			added = true
+		}
+		chain = append(chain, spec)
+	}
+	if !added {
+		chain = append(chain, ResolverSpec{Name: "cache", Arg: gopath})
+	}
+	return chain
+}
+
+// WithRemote returns the chain, or if it has no remote resolvers a
+// copy of it with remote and default added, so repos not on disk may
+// be fetched.
+func (rc ResolverChain) WithRemote() ResolverChain {
+	for _, spec := range rc {
+		if RepoResolvers[spec.Name] != nil && RepoResolvers[spec.Name].Remote {
+			return rc
+		}
+	}
+	chain := make(ResolverChain, 0, len(rc)+2)
+	chain = append(chain, rc...)
+	return append(chain, ResolverSpec{Name: "remote"}, ResolverSpec{Name: "default"})
+}
+
+func registeredResolvers() []string {
+	names := make([]string, 0, len(RepoResolvers))
+	for name := range RepoResolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolverFlags holds the resolver chain and repo cache controls for
+// a command.
+type ResolverFlags struct {
+	Chain ResolverChain
+	Cache RepoCacheFlags
+}
+
+// Register adds the -resolvers and cache flags to f. The default
+// chain is read from $CANTICLE_<CMD>_RESOLVERS if set, otherwise
+// defaultChain is used.
+func (rf *ResolverFlags) Register(f *flag.FlagSet, defaultChain string) {
+	env := "CANTICLE_" + strings.ToUpper(f.Name()) + "_RESOLVERS"
+	rf.Chain, _ = ParseResolverChain(defaultChain)
+	if envChain := os.Getenv(env); envChain != "" {
+		chain, err := ParseResolverChain(envChain)
+		if err != nil {
+			LogWarn("Ignoring %s: %s", env, err.Error())
+		} else {
+			rf.Chain = chain
+		}
+	}
+	f.Var(&rf.Chain, "resolvers", "Comma separated list of resolvers ("+strings.Join(registeredResolvers(), ", ")+") used in order to find repos.")
+	rf.Cache.Register(f)
+}
+
+// Resolver builds the chain into a single memoized RepoResolver
+// working in gopath. Adjacent remote resolvers are wrapped in a
+// CachedRepoResolver unless the cache is disabled.
+func (rf *ResolverFlags) Resolver(gopath string) (RepoResolver, error) {
+	if len(rf.Chain) == 0 {
+		return nil, errors.New("no resolvers configured")
+	}
+	var cache *RepoCache
+	var resolvers, group []RepoResolver
+	var names []string
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		var r RepoResolver = &CompositeRepoResolver{group}
+		if cache == nil && !rf.Cache.NoCache {
+			var err error
+			if cache, err = rf.Cache.Load(); err != nil {
+				return err
+			}
+		}
+		if cache != nil {
+			r = &CachedRepoResolver{
+				Cache:    cache,
+				Resolver: r,
+				Gopath:   gopath,
+				Refresh:  rf.Cache.Refresh,
+				Name:     strings.Join(names, ","),
+			}
+		}
+		resolvers = append(resolvers, r)
+		group, names = nil, nil
+		return nil
+	}
+	for _, spec := range rf.Chain {
+		factory := RepoResolvers[spec.Name]
+		if factory == nil {
+			return nil, fmt.Errorf("unknown resolver %s", spec.Name)
+		}
+		r, err := factory.New(gopath, spec.Arg)
+		if err != nil {
+			return nil, fmt.Errorf("cant create resolver %s %s", spec.String(), err.Error())
+		}
+		if !factory.Remote {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			resolvers = append(resolvers, r)
+			continue
+		}
+		group = append(group, r)
+		names = append(names, spec.String())
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	memoized := NewMemoizedRepoResolver(&CompositeRepoResolver{resolvers})
+	return &SignatureRepoResolver{memoized}, nil
+}
+
+// CacheResolver builds the chain into a RepoResolver working in
+// dest, a GOPATH other than cache, with the repos in cache used as a
+// local cache. See WithCache.
+func (rf *ResolverFlags) CacheResolver(dest, cache string) (RepoResolver, error) {
+	flags := *rf
+	flags.Chain = rf.Chain.WithCache(cache)
+	return flags.Resolver(dest)
+}
+
+// FetchResolver builds the chain with remote resolvers, see
+// WithRemote, into a RepoResolver working in gopath.
+func (rf *ResolverFlags) FetchResolver(gopath string) (RepoResolver, error) {
+	flags := *rf
+	flags.Chain = rf.Chain.WithRemote()
+	return flags.Resolver(gopath)
+}
+
+// candidateRoots returns the possible repo roots for importPath,
+// shortest first. If dep has a Root only it is returned.
+func candidateRoots(importPath string, dep *CanticleDependency) []string {
+	if dep != nil && dep.Root != "" {
+		return []string{dep.Root}
+	}
+	parts := strings.Split(strings.TrimSuffix(importPath, "/"), "/")
+	roots := make([]string, 0, len(parts))
+	for i := range parts {
+		roots = append(roots, strings.Join(parts[:i+1], "/"))
+	}
+	return roots
+}
+
+// MirrorRepoResolver resolves repos against a mirror. URL is a
+// template where {root} is replaced with the repo root being tried,
+// for example https://mirror.example.com/{root}.git.
+type MirrorRepoResolver struct {
+	Gopath string
+	URL    string
+}
+
+// NewMirrorRepoResolver returns a MirrorRepoResolver for the url
+// template, which must contain {root}.
+func NewMirrorRepoResolver(gopath, url string) (*MirrorRepoResolver, error) {
+	if !strings.Contains(url, "{root}") {
+		return nil, fmt.Errorf("mirror url %q must contain {root}", url)
+	}
+	return &MirrorRepoResolver{Gopath: gopath, URL: url}, nil
+}
+
+// ResolveRepo on a MirrorRepoResolver pings the mirror for each
+// possible root of importPath, shortest first, and returns a
+// PackageVCS for the first that responds.
+func (mr *MirrorRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	re := NewResolutionFailureError(importPath, "mirror")
+	for _, root := range candidateRoots(importPath, dep) {
+		url := strings.Replace(mr.URL, "{root}", root, -1)
+		LogVerbose("Attempting mirror url %s for %s", url, importPath)
+		v, attempts := PingVCS(url)
+		if v != nil {
+			return &PackageVCS{
+				Repo:   &vcs.RepoRoot{VCS: v, Repo: url, Root: root},
+				Gopath: mr.Gopath,
+			}, nil
+		}
+		for _, attempt := range attempts {
+			attempt.Resolver = "mirror"
+			attempt.ImportPath = importPath
+		}
+		re.Attempts = append(re.Attempts, attempts...)
+	}
+	return nil, re
+}
+
+// CacheRepoResolver resolves repos already in the Cache GOPATH and
+// copies them from there, with their VCS metadata, into Gopath.
+// Revisions already in the cache are checked out without updating
+// from remotes, so it should be kept up to date.
+type CacheRepoResolver struct {
+	Gopath string
+	Cache  string
+}
+
+// NewCacheRepoResolver returns a CacheRepoResolver cloning from the
+// GOPATH cache into gopath, they may not be the same.
+func NewCacheRepoResolver(gopath, cache string) (*CacheRepoResolver, error) {
+	if cache == "" {
+		return nil, errors.New("cache resolver needs a GOPATH to clone from")
+	}
+	for _, entry := range filepath.SplitList(cache) {
+		if filepath.Clean(entry) == filepath.Clean(gopath) {
+			return nil, fmt.Errorf("cache %s may not be the GOPATH it fetches into", cache)
+		}
+	}
+	return &CacheRepoResolver{Gopath: gopath, Cache: cache}, nil
+}
+
+// ResolveRepo on a CacheRepoResolver finds the repo of importPath in
+// Cache with a LocalRepoResolver and returns it with Gopath as its
+// DestPath.
+func (cr *CacheRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	v, err := (&LocalRepoResolver{LocalPath: cr.Cache}).ResolveRepo(importPath, dep)
+	if err != nil {
+		re := NewResolutionFailureError(importPath, "cache")
+		re.Attempts = resolutionAttempts(cr, importPath, err)
+		for _, attempt := range re.Attempts {
+			attempt.Resolver = "cache"
+		}
+		return nil, re
+	}
+	lv, ok := v.(*LocalVCS)
+	if !ok {
+		return nil, fmt.Errorf("cant copy %s from cache, not a local vcs %T", importPath, v)
+	}
+	lv.DestPath = cr.Gopath
+	lv.CopyDot = true
+	return lv, nil
+}
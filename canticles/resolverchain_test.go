@@ -0,0 +1,114 @@
+package canticles
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseResolverChain(t *testing.T) {
+	chain, err := ParseResolverChain("local, mirror=https://mirror.test.com/{root}.git,default")
+	if err != nil {
+		t.Fatalf("ParseResolverChain returned error for valid chain: %s", err.Error())
+	}
+	expected := ResolverChain{
+		{Name: "local"},
+		{Name: "mirror", Arg: "https://mirror.test.com/{root}.git"},
+		{Name: "default"},
+	}
+	if !reflect.DeepEqual(expected, chain) {
+		t.Errorf("ParseResolverChain returned %+v expected %+v", chain, expected)
+	}
+	if chain.String() != "local,mirror=https://mirror.test.com/{root}.git,default" {
+		t.Errorf("ResolverChain String returned %s", chain.String())
+	}
+
+	if _, err := ParseResolverChain("local,nothere"); err == nil {
+		t.Errorf("ParseResolverChain returned no error for unknown resolver")
+	}
+}
+
+func TestResolverFlags(t *testing.T) {
+	os.Setenv("CANTICLE_RESOLVERTEST_RESOLVERS", "local")
+	defer os.Unsetenv("CANTICLE_RESOLVERTEST_RESOLVERS")
+	f := flag.NewFlagSet("resolvertest", flag.ContinueOnError)
+	rf := &ResolverFlags{}
+	rf.Register(f, "local,remote,default")
+	if rf.Chain.String() != "local" {
+		t.Errorf("ResolverFlags did not use chain from environment got %s", rf.Chain.String())
+	}
+	if err := f.Parse([]string{"-resolvers", "local,remote,mirror=git://mirror.test.com/{root}", "-no-cache"}); err != nil {
+		t.Fatalf("ResolverFlags error parsing valid flags: %s", err.Error())
+	}
+
+	r, err := rf.Resolver("/home/go")
+	if err != nil {
+		t.Fatalf("ResolverFlags returned error building valid chain: %s", err.Error())
+	}
+	cr := r.(*SignatureRepoResolver).Resolver.(*MemoizedRepoResolver).resolver.(*CompositeRepoResolver)
+	if len(cr.Resolvers) != 2 {
+		t.Fatalf("ResolverFlags expected local and a remote group got %d resolvers", len(cr.Resolvers))
+	}
+	if _, ok := cr.Resolvers[0].(*LocalRepoResolver); !ok {
+		t.Errorf("ResolverFlags expected first resolver to be local got %T", cr.Resolvers[0])
+	}
+	group, ok := cr.Resolvers[1].(*CompositeRepoResolver)
+	if !ok {
+		t.Fatalf("ResolverFlags expected uncached remote group got %T", cr.Resolvers[1])
+	}
+	if len(group.Resolvers) != 2 {
+		t.Errorf("ResolverFlags expected remote group of 2 got %d", len(group.Resolvers))
+	}
+	if m, ok := group.Resolvers[1].(*MirrorRepoResolver); !ok || m.URL != "git://mirror.test.com/{root}" {
+		t.Errorf("ResolverFlags bad mirror resolver %+v", group.Resolvers[1])
+	}
+
+	rf.Chain = nil
+	if _, err := rf.Resolver("/home/go"); err == nil {
+		t.Errorf("ResolverFlags returned no error for empty chain")
+	}
+}
+
+func TestCandidateRoots(t *testing.T) {
+	roots := candidateRoots("test.com/a/b", nil)
+	expected := []string{"test.com", "test.com/a", "test.com/a/b"}
+	if !reflect.DeepEqual(expected, roots) {
+		t.Errorf("candidateRoots returned %v expected %v", roots, expected)
+	}
+	roots = candidateRoots("test.com/a/b", &CanticleDependency{Root: "test.com/a"})
+	if !reflect.DeepEqual([]string{"test.com/a"}, roots) {
+		t.Errorf("candidateRoots did not use dep root %v", roots)
+	}
+}
+
+func TestResolverChainWithCache(t *testing.T) {
+	chain, _ := ParseResolverChain("local,remote,default")
+	if cached := chain.WithCache("/home/go"); cached.String() != "local,cache=/home/go,remote,default" {
+		t.Errorf("WithCache expected cache before remote resolvers got %s", cached.String())
+	}
+	if chain.String() != "local,remote,default" {
+		t.Errorf("WithCache modified chain %s", chain.String())
+	}
+	chain, _ = ParseResolverChain("local")
+	if cached := chain.WithCache("/home/go"); cached.String() != "local,cache=/home/go" {
+		t.Errorf("WithCache expected cache last got %s", cached.String())
+	}
+	if _, err := NewCacheRepoResolver("/home/go", "/home/go/"); err == nil {
+		t.Errorf("NewCacheRepoResolver returned no error caching into itself")
+	}
+}
+
+func TestResolverChainWithRemote(t *testing.T) {
+	chain, _ := ParseResolverChain("local")
+	if fetch := chain.WithRemote(); fetch.String() != "local,remote,default" {
+		t.Errorf("WithRemote expected remote resolvers added got %s", fetch.String())
+	}
+	if chain.String() != "local" {
+		t.Errorf("WithRemote modified chain %s", chain.String())
+	}
+	chain, _ = ParseResolverChain("local,mirror=https://mirror.example.com/{root}")
+	if fetch := chain.WithRemote(); fetch.String() != chain.String() {
+		t.Errorf("WithRemote expected chain with a remote resolver unchanged got %s", fetch.String())
+	}
+}
@@ -1,13 +1,12 @@
 package canticles
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"sort"
+	"strings"
 )
 
 type Save struct {
@@ -18,7 +17,14 @@ type Save struct {
 	OnDisk    bool
 	Branches  bool
 	NoSources bool
+	Resolve   string
+	Strict    bool
+	Fetch     bool
+	Merge     bool
+	Drop      bool
 	Excludes  DirFlags
+	Platforms BuildContexts
+	Resolvers ResolverFlags
 	Resolver  ConflictResolver
 }
 
@@ -34,8 +40,15 @@ func NewSave() *Save {
 	f.BoolVar(&s.OnDisk, "ondisk", false, "Save the revisions and sources present on disk ignoring all other Canticle files.")
 	f.BoolVar(&s.DryRun, "d", false, "Don't save the deps, just print them.")
 	f.BoolVar(&s.Branches, "b", false, "Save branches for the current projects, not revisions.")
+	f.StringVar(&s.Resolve, "resolve", "prompt", "Resolve conflicts with prompt, ondisk, newest, fail or authority=<Canticle file>.")
+	f.BoolVar(&s.Fetch, "fetch", false, "Fetch imports not found on disk instead of failing.")
+	f.BoolVar(&s.Merge, "merge", false, "Keep the existing entries for dependencies still in use and print what changed.")
+	f.BoolVar(&s.Drop, "drop-unused", false, "With -merge drop the existing entries for dependencies no longer in use.")
+	f.BoolVar(&s.Strict, "strict", false, "Refuse to save revisions which are not on any remote.")
 	f.BoolVar(&s.NoSources, "no-sources", false, "Don't save a sources for the current projects, not revisions.")
 	f.Var(&s.Excludes, "exclude", "Do not recur into these directories when saving unless they are in the dep tree.")
+	f.Var(&s.Platforms, "platform", "Read imports under this goos/goarch[:tags], may be repeated.")
+	s.Resolvers.Register(f, "local")
 	return s
 }
 
@@ -43,15 +56,39 @@ var save = NewSave()
 
 var SaveCommand = &Command{
 	Name:             "save",
-	UsageLine:        "save [-d] [-b] [-v] [-ondisk] [-exclude <dir>] [-no-sources]",
-	ShortDescription: "Save the current revision of all dependencies in a Canticle file.",
-	LongDescription: `The save command will save the dependencies for a package into a Canticle file.  If at the src level save the current revision of all packages in belows. All dependencies must be present on disk and in the GOROOT. The generated Canticle file will be saved in the packages root directory.
+	UsageLine:        "save [-d] [-b] [-v] [-ondisk] [-fetch] [-merge] [-drop-unused] [-strict] [-resolve <resolution>] [-exclude <dir>] [-no-sources] [-platform <goos/goarch[:tags]>] [-resolvers <list>]",
+	ShortDescription: "Save the current revision of all dependencies in a Canticle.lock file.",
+	LongDescription: `The save command will save the dependencies for a package into a Canticle.lock file.  If at the src level save the current revision of all packages in belows. All dependencies must be present on disk and in the GOROOT. The generated files will be saved in the packages root directory.
+
+The Canticle.lock holds the exact revision of each dependency, the branch it was on and a hash of its committed tree which get, vendor and verify check. Uncommitted changes in dependencies are not locked and are warned about. It is generated and should not be edited, get fetches the revisions it lists. The Canticle file holds the branches, tags or revisions the project wants and may be edited by hand, use update to resolve it into a new lock. Save writes a Canticle file, using the branch on disk of each dependency where there is one, if the project does not have one yet.
 
 Specify -v to print out a verbose set of operations instead of just errors.
 
 Specify -ondisk to use on disk revisions and sources and do no conflict resolution.
 
-Specify -b to save branches or tags when present instead of revisions`,
+Specify -fetch to fetch imports not found on disk, and then read their imports, instead of failing. Those pinned by the Canticle.lock or Canticle file of the project are fetched at their pinned revision and source, others at their default revision. They are fetched with the -resolvers chain, with remote and default added if it has no remote resolvers, so a new project may be saved in one step.
+
+Specify -resolve to choose how conflicting revisions and sources wanted by the Canticle files of dependencies are resolved:
+    prompt (the default) asks which to use.
+    ondisk uses the revisions and sources on disk, as -ondisk.
+    newest uses the newest revision, a descendant of the others or else the latest commit, and the source on disk.
+    fail saves nothing and reports every conflict if there are any.
+    authority=<Canticle file> uses the revisions and sources pinned in the given Canticle file, and fails on conflicts it does not pin. Given a directory its Canticle.lock is used, or its Canticle file when it has no lock.
+All but prompt run without a human, for example in CI.
+
+Each saved revision is checked against the remote tracking refs already fetched into its repo, without accessing the network, and revisions on no remote are warned about since nobody else can get them. Specify -strict to save nothing instead if there are any.
+
+Specify -merge to merge into the existing Canticle file instead of replacing it, the Canticle file is written even if it exists. Existing entries for Roots still in use are kept as they are, with any hand set SourcePath, All or revision, and new Roots are added. Entries for Roots no longer in use are kept unless -drop-unused is given. The added and dropped entries are printed. The Canticle.lock is then rebuilt from the merged Canticle file, locking each entry to the revision on disk or to the revision it names.
+
+Specify -b to rewrite the Canticle file from the branches on disk, and to resolve conflicts between branches instead of revisions.
+
+Tool dependencies declared in the existing Canticle file or lock, see the tools command, are kept, as are Signature policies.
+
+Save records the scope of each dependency: runtime if imported by non test files of the project or another runtime dependency, test if only reached through test files.
+
+Specify -platform to read imports under a matrix of build contexts instead of only the current GOOS and GOARCH, for example -platform linux/amd64 -platform windows/amd64 -platform darwin/arm64:cgo. Dependencies are saved if needed on any platform, and those not needed on every platform record the platforms they are needed on.
+
+Specify -resolvers to control how the repos of dependencies are found. The default is local and may be changed with $CANTICLE_SAVE_RESOLVERS.`,
 	Flags: save.flags,
 	Cmd:   save,
 }
@@ -67,10 +104,6 @@ func (s *Save) Run(args []string) {
 	}
 	defer func() { Quite = false }()
 
-	if s.OnDisk {
-		s.Resolver = &PreferLocalResolution{}
-	}
-
 	wd, err := os.Getwd()
 	if err != nil {
 		log.Fatal(err)
@@ -79,16 +112,24 @@ func (s *Save) Run(args []string) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if s.Resolver, err = NewConflictResolver(s.Resolve, gopath); err != nil {
+		log.Fatal(err)
+	}
+	if s.OnDisk {
+		s.Resolver = &PreferLocalResolution{}
+	}
 	if err := s.SaveProject(gopath, wd); err != nil {
 		log.Fatal(err)
 	}
 }
 
-// SaveProject does four things:
+// SaveProject does five things:
 //   *  It fetches the dep tree of path
 //   *  It fetches all possible DependencySources
 //   *  It performs conflict resolution
-//   *  It saves a Canticle file in path
+//   *  It saves a Canticle.lock in path
+//   *  It saves a Canticle file in path if there is none, or if
+//      branches are being saved
 func (s *Save) SaveProject(gopath, path string) error {
 	LogVerbose("Working with gopath %s", gopath)
 	deps, err := s.ReadDeps(gopath, path)
@@ -104,18 +145,273 @@ func (s *Save) SaveProject(gopath, path string) error {
 	if err != nil {
 		return err
 	}
+	s.RecordScopes(sources, cantdeps)
+	if len(s.Platforms) > 0 {
+		s.RecordPlatforms(sources, cantdeps)
+	}
 
-	if err := s.SaveDeps(path, cantdeps); err != nil {
+	pkg, err := PackageName(gopath, path)
+	if err != nil {
 		return err
 	}
+	reader := &DepReader{Gopath: gopath}
+	intent, err := reader.IntentDependencies(pkg)
+	hasIntent := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cant read existing Canticle file %s", err.Error())
+	}
+	locked, err := reader.LockedDependencies(pkg)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cant read existing Canticle.lock %s", err.Error())
+	}
+
+	var intentDeps []*CanticleDependency
+	saveIntent := !hasIntent || s.Branches || s.Merge
+	if saveIntent {
+		intentDeps = KeepSignatures(intent, KeepTools(intent, IntentDeps(sources, cantdeps)))
+	}
+
+	// Tools newly declared in the Canticle file are locked as
+	// declared until the next update
+	existing := append(locked, intent...)
+	var lockDeps []*CanticleDependency
+	if s.Merge {
+		intentDeps = s.MergeFile(DependencyFile(path), intent, intentDeps)
+		lockDeps, err = LockMerged(gopath, sources, intentDeps, locked)
+	} else {
+		lockDeps, err = LockDeps(gopath, sources, cantdeps)
+	}
+	if err != nil {
+		return err
+	}
+	lockDeps = KeepSignatures(existing, KeepTools(existing, lockDeps))
+	if err := s.CheckPushed(gopath, lockDeps); err != nil {
+		return err
+	}
+
+	if saveIntent {
+		if err := s.SaveDeps(DependencyFile(path), NewCanticleFile(pkg, intentDeps)); err != nil {
+			return err
+		}
+	}
+	return s.SaveDeps(LockFile(path), NewCanticleFile(pkg, lockDeps))
+}
+
+// LockMerged locks the merged deps of a Canticle file with LockDeps,
+// so deps in use are locked to the revision the file names. Unused
+// deps kept in the file which can not be locked, for example as they
+// are not on disk, keep their entry in locked or else are locked as
+// declared.
+func LockMerged(gopath string, sources *DependencySources, merged, locked []*CanticleDependency) ([]*CanticleDependency, error) {
+	lockDeps := make([]*CanticleDependency, 0, len(merged))
+	for _, cdep := range merged {
+		lock, err := LockDeps(gopath, sources, []*CanticleDependency{cdep})
+		if err == nil {
+			lockDeps = append(lockDeps, lock...)
+			continue
+		}
+		if sources.DepSource(cdep.Root) != nil {
+			return nil, err
+		}
+		LogWarn("Keeping the lock of unused %s, %s", cdep.Root, err.Error())
+		kept := cdep
+		for _, existing := range locked {
+			if existing.Root == cdep.Root {
+				kept = existing
+			}
+		}
+		lockDeps = append(lockDeps, kept)
+	}
+	return lockDeps, nil
+}
+
+// MergeFile merges cantdeps into the existing deps of file, see
+// MergeDeps, and prints what changed.
+func (s *Save) MergeFile(file string, existing, cantdeps []*CanticleDependency) []*CanticleDependency {
+	merged, diff := MergeDeps(existing, cantdeps, s.Drop)
+	if len(diff) == 0 {
+		fmt.Printf("%s: no changes\n", file)
+	} else {
+		fmt.Printf("%s:\n\t%s\n", file, strings.Join(diff, "\n\t"))
+	}
+	return merged
+}
+
+// MergeDeps returns the existing deps whose Root is in cantdeps, then
+// those of cantdeps not in existing. Existing deps not in cantdeps are
+// dropped if drop is true, otherwise kept. The diff lists each added
+// (+) and dropped (-) Root with its revision and each unused Root kept.
+func MergeDeps(existing, cantdeps []*CanticleDependency, drop bool) (merged []*CanticleDependency, diff []string) {
+	used := NewStringSet()
+	for _, cdep := range cantdeps {
+		used.Add(cdep.Root)
+	}
+	kept := NewStringSet()
+	for _, cdep := range existing {
+		switch {
+		case kept[cdep.Root]:
+			continue
+		case used[cdep.Root]:
+		case drop:
+			diff = append(diff, fmt.Sprintf("- %s %s", cdep.Root, cdep.Revision))
+			continue
+		default:
+			diff = append(diff, fmt.Sprintf("  %s %s unused, kept", cdep.Root, cdep.Revision))
+		}
+		kept.Add(cdep.Root)
+		merged = append(merged, cdep)
+	}
+	for _, cdep := range cantdeps {
+		if kept[cdep.Root] {
+			continue
+		}
+		diff = append(diff, fmt.Sprintf("+ %s %s", cdep.Root, cdep.Revision))
+		kept.Add(cdep.Root)
+		merged = append(merged, cdep)
+	}
+	return merged, diff
+}
+
+// CheckPushed warns about each of cantdeps whose Revision is not on
+// a remote of its repo on disk, or with Strict returns an error
+// listing them. Repos not on disk, or whose VCS can not tell, are
+// skipped.
+func (s *Save) CheckPushed(gopath string, cantdeps []*CanticleDependency) error {
+	resolver := &LocalRepoResolver{LocalPath: gopath}
+	var unpushed []string
+	for _, cdep := range cantdeps {
+		if cdep.Revision == "" {
+			continue
+		}
+		v, err := resolver.ResolveRepo(cdep.Root, nil)
+		if err != nil {
+			LogVerbose("Not checking %s is pushed %s", cdep.Root, err.Error())
+			continue
+		}
+		lv, ok := v.(*LocalVCS)
+		if !ok {
+			continue
+		}
+		pushed, err := lv.RevPushed(cdep.Revision)
+		switch {
+		case err != nil:
+			LogWarn("Cant check %s revision %s is pushed %s", cdep.Root, cdep.Revision, err.Error())
+		case !pushed:
+			unpushed = append(unpushed, fmt.Sprintf("%s %s", cdep.Root, cdep.Revision))
+		}
+	}
+	if len(unpushed) == 0 {
+		return nil
+	}
+	if s.Strict {
+		return fmt.Errorf("cant save revisions on no remote, push them first:\n\t%s", strings.Join(unpushed, "\n\t"))
+	}
+	LogWarn("Saving revisions on no remote, others will not be able to get them until they are pushed:\n\t%s", strings.Join(unpushed, "\n\t"))
 	return nil
 }
 
+// LockDeps returns copies of cantdeps locked to exact revisions.
+// Deps resolved to their on disk revision, or to a revision naming the
+// commit on disk, record the commit, branch and hash of the commit on
+// disk, only the repos of those deps are hashed and uncommitted
+// changes in them are warned about as they are not locked. Other
+// revisions, which may be branches, tags or constraints, are resolved
+// to the exact revision in the repo in gopath, it is an error if they
+// can not be.
+func LockDeps(gopath string, sources *DependencySources, cantdeps []*CanticleDependency) ([]*CanticleDependency, error) {
+	resolver := &LocalRepoResolver{LocalPath: gopath}
+	locked := make([]*CanticleDependency, 0, len(cantdeps))
+	for _, cdep := range cantdeps {
+		lock := *cdep
+		lock.Branch = ""
+		lock.Hash = ""
+		source := sources.DepSource(cdep.Root)
+		onDisk := source != nil && cdep.Revision == source.OnDiskRevision
+		if !onDisk {
+			commit, err := lockCommit(resolver, cdep)
+			if err != nil {
+				return nil, fmt.Errorf("cant lock %s to %s %s", cdep.Root, cdep.Revision, err.Error())
+			}
+			lock.Revision = commit
+			onDisk = source != nil && commit == source.OnDiskCommit
+			if !onDisk {
+				LogWarn("Locking %s to %s (%s) which is not the revision on disk", cdep.Root, commit, cdep.Revision)
+				locked = append(locked, &lock)
+				continue
+			}
+		}
+		lock.Revision = source.OnDiskCommit
+		lock.Branch = source.OnDiskBranch
+		if hash, err := HashTree(PackageSource(gopath, cdep.Root), lock.Revision); err == nil {
+			lock.Hash = hash
+		} else {
+			LogWarn("Cant hash %s %s", cdep.Root, err.Error())
+		}
+		warnChanges(resolver, cdep.Root, lock.Revision)
+		locked = append(locked, &lock)
+	}
+	return locked, nil
+}
+
+// warnChanges warns if the repo of root has uncommitted changes,
+// which locking it at rev leaves out.
+func warnChanges(resolver RepoResolver, root, rev string) {
+	v, err := resolver.ResolveRepo(root, nil)
+	if err != nil {
+		return
+	}
+	lv, ok := v.(*LocalVCS)
+	if !ok || lv.Changes == nil {
+		return
+	}
+	if changes, err := lv.LocalChanges(); err == nil && len(changes) > 0 {
+		LogWarn("Locking %s at %s without its %d uncommitted changes, commit them to lock them:\n\t%s", root, rev, len(changes), strings.Join(changes, "\n\t"))
+	}
+}
+
+// lockCommit resolves the Revision of cdep to an exact revision with
+// the repo of cdep found by resolver.
+func lockCommit(resolver RepoResolver, cdep *CanticleDependency) (string, error) {
+	if cdep.Revision == "" {
+		return "", errors.New("no revision to lock")
+	}
+	v, err := resolver.ResolveRepo(cdep.Root, nil)
+	if err != nil {
+		return "", err
+	}
+	lv, ok := v.(*LocalVCS)
+	if !ok {
+		return "", fmt.Errorf("cant resolve revisions of a %T", v)
+	}
+	return lv.ResolveCommit(cdep.Revision)
+}
+
+// IntentDeps returns copies of cantdeps suitable for a Canticle
+// file, deps at their on disk revision are saved with the branch on
+// disk if there is one.
+func IntentDeps(sources *DependencySources, cantdeps []*CanticleDependency) []*CanticleDependency {
+	intent := make([]*CanticleDependency, 0, len(cantdeps))
+	for _, cdep := range cantdeps {
+		dep := *cdep
+		dep.Branch = ""
+		dep.Hash = ""
+		source := sources.DepSource(cdep.Root)
+		if source != nil && source.OnDiskBranch != "" && cdep.Revision == source.OnDiskRevision {
+			dep.Revision = source.OnDiskBranch
+		}
+		intent = append(intent, &dep)
+	}
+	return intent
+}
+
 // GetSources returns the DependencySources (e.g. the possible revisions, vcs sources, and deps)
 // for a give path, and set Dependencies.
 func (s *Save) GetSources(gopath, path string, deps Dependencies) (*DependencySources, error) {
 	LogVerbose("Getting local vcs sources for repos in path %+v", gopath)
-	repoResolver := NewMemoizedRepoResolver(&LocalRepoResolver{gopath})
+	repoResolver, err := s.Resolvers.Resolver(gopath)
+	if err != nil {
+		return nil, err
+	}
 	reader := &DepReader{Gopath: gopath}
 	sourceResolver := &SourcesResolver{
 		Gopath:     gopath,
@@ -131,27 +427,129 @@ func (s *Save) GetSources(gopath, path string, deps Dependencies) (*DependencySo
 // ReadDeps reads all dependencies and transitive deps for path.
 func (s *Save) ReadDeps(gopath, path string) (Dependencies, error) {
 	LogVerbose("Reading deps for repos in path %s", path)
-	reader := &DepReader{Gopath: gopath}
+	reader := &DepReader{Gopath: gopath, Platforms: s.Platforms}
 	ds := NewDependencySaver(reader.AllDeps, gopath, path)
 	ds.NoRecur = StringSet(s.Excludes)
+	pkg, err := PackageName(gopath, path)
+	if err != nil {
+		return nil, err
+	}
+	if s.Fetch {
+		fetch, err := s.Resolvers.FetchResolver(gopath)
+		if err != nil {
+			return nil, err
+		}
+		ds.Fetch = fetch
+		// Fetch pinned deps at their pins, not the default branch
+		ds.Pinned, err = reader.CanticleDependencies(pkg)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cant read Canticle file of %s %s", pkg, err.Error())
+		}
+	}
 	dw := NewDependencyWalker(ds.PackagePaths, ds.SavePackageDeps)
 	if err := dw.TraverseDependencies(path); err != nil {
 		return nil, fmt.Errorf("cant read path dep tree %s %s", path, err.Error())
 	}
-	LogVerbose("Built dep tree: %+v", ds.Dependencies())
-	return ds.Dependencies(), nil
+	deps := ds.Dependencies()
+	// Packages we are saving, and those nothing imports, are
+	// needed everywhere
+	isRoot := func(dep *Dependency) bool {
+		return dep.ImportedFrom.Size() == 0 || PathIsChild(pkg, dep.ImportPath)
+	}
+	deps.PropagateScopes(isRoot)
+	if len(s.Platforms) > 0 {
+		deps.PropagatePlatforms(s.Platforms.Strings(), isRoot)
+	}
+	LogVerbose("Built dep tree: %+v", deps)
+	return deps, nil
 }
 
-// SaveDeps saves a canticle file at path containing deps.
-func (s *Save) SaveDeps(path string, deps []*CanticleDependency) error {
-	sort.Sort(CanticleDependencies(deps))
-	j, err := json.MarshalIndent(deps, "", "    ")
-	if err != nil {
-		return err
+// KeepTools adds the tool dependencies in existing to cantdeps. Tools
+// are never imported so their entries are kept as is, unless their
+// root is already in cantdeps in which case only the tools are copied
+// over.
+func KeepTools(existing, cantdeps []*CanticleDependency) []*CanticleDependency {
+	for _, tool := range existing {
+		if len(tool.Tools) == 0 {
+			continue
+		}
+		found := false
+		for _, cdep := range cantdeps {
+			if cdep.Root == tool.Root {
+				cdep.Tools = tool.Tools
+				found = true
+			}
+		}
+		if !found {
+			LogVerbose("Keeping tool dependency %s", tool.Root)
+			cantdeps = append(cantdeps, tool)
+		}
 	}
+	return cantdeps
+}
+
+// KeepSignatures copies the signature policies in existing to the
+// cantdeps with the same root. Later entries in existing win.
+func KeepSignatures(existing, cantdeps []*CanticleDependency) []*CanticleDependency {
+	for _, signed := range existing {
+		if signed.Signature == nil {
+			continue
+		}
+		for _, cdep := range cantdeps {
+			if cdep.Root == signed.Root {
+				cdep.Signature = signed.Signature
+			}
+		}
+	}
+	return cantdeps
+}
+
+// RecordScopes sets the Scope of each cantdep to the widest scope
+// of its packages.
+func (s *Save) RecordScopes(sources *DependencySources, cantdeps []*CanticleDependency) {
+	for _, cdep := range cantdeps {
+		source := sources.DepSource(cdep.Root)
+		if source == nil {
+			continue
+		}
+		scope := ""
+		for _, dep := range source.Deps {
+			scope = WiderScope(scope, dep.Scope)
+		}
+		if scope != "" {
+			cdep.Scope = scope
+		}
+	}
+}
+
+// RecordPlatforms sets the Platforms of each cantdep to the union of
+// the platforms its packages are needed on. Cantdeps needed on every
+// platform are left empty.
+func (s *Save) RecordPlatforms(sources *DependencySources, cantdeps []*CanticleDependency) {
+	for _, cdep := range cantdeps {
+		source := sources.DepSource(cdep.Root)
+		if source == nil {
+			continue
+		}
+		platforms := NewStringSet()
+		for _, dep := range source.Deps {
+			platforms.Union(dep.Platforms)
+		}
+		if platforms.Size() < len(s.Platforms) {
+			cdep.Platforms = platforms.Array()
+		}
+	}
+}
+
+// SaveDeps saves cf to file, or prints it on a dry run.
+func (s *Save) SaveDeps(file string, cf *CanticleFile) error {
 	if s.DryRun {
-		fmt.Println(string(j))
+		j, err := cf.Marshal()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s:\n%s", file, string(j))
 		return nil
 	}
-	return ioutil.WriteFile(DependencyFile(path), j, 0644)
+	return WriteCanticleFile(file, cf)
 }
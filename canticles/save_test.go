@@ -0,0 +1,239 @@
+package canticles
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeDeps(t *testing.T) {
+	existing := []*CanticleDependency{
+		{Root: "a", Revision: "old", SourcePath: "git@example.com:a", All: true},
+		{Root: "b", Revision: "b1"},
+	}
+	cantdeps := []*CanticleDependency{
+		{Root: "a", Revision: "new"},
+		{Root: "c", Revision: "c1"},
+	}
+
+	merged, diff := MergeDeps(existing, cantdeps, false)
+	if len(merged) != 3 || merged[0] != existing[0] || merged[1] != existing[1] || merged[2] != cantdeps[1] {
+		t.Errorf("Expected existing a and b kept and c added got %+v", merged)
+	}
+	expected := []string{"  b b1 unused, kept", "+ c c1"}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected diff %v got %v", expected, diff)
+	}
+
+	merged, diff = MergeDeps(existing, cantdeps, true)
+	if len(merged) != 2 || merged[0] != existing[0] || merged[1] != cantdeps[1] {
+		t.Errorf("Expected unused b dropped got %+v", merged)
+	}
+	expected = []string{"- b b1", "+ c c1"}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected diff %v got %v", expected, diff)
+	}
+
+	if _, diff = MergeDeps(cantdeps, cantdeps, true); len(diff) != 0 {
+		t.Errorf("Expected no diff merging into the same deps got %v", diff)
+	}
+
+	// Saving with -merge keeps the Canticle file entries but locks
+	// the revision now on disk
+	gopath, err := ioutil.TempDir("", "cant-test-merge")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	dep := newTestGitRepo(t, gopath, "test.com/a")
+	dep.write("a.go", "package a\n")
+	old := dep.commit("a", "one")
+	app := newTestGitRepo(t, gopath, "test.com/app")
+	app.write("app.go", "package app\n\nimport _ \"test.com/a\"\n")
+	app.commit("b", "one")
+	intent := []*CanticleDependency{{Root: "test.com/a", Revision: "master", SourcePath: "git@example.com:a", All: true}}
+	if err := WriteCanticleFile(DependencyFile(app.dir), NewCanticleFile("test.com/app", intent)); err != nil {
+		t.Fatalf("Error writing Canticle file: %s", err.Error())
+	}
+	lock := []*CanticleDependency{{Root: "test.com/a", Revision: old}}
+	if err := WriteCanticleFile(LockFile(app.dir), NewCanticleFile("test.com/app", lock)); err != nil {
+		t.Fatalf("Error writing Canticle.lock: %s", err.Error())
+	}
+	updated := dep.commit("a", "two")
+	hash, err := HashTree(dep.dir, updated)
+	if err != nil {
+		t.Fatalf("HashTree returned error %s", err.Error())
+	}
+
+	s := NewSave()
+	s.Merge = true
+	s.Resolver = &PreferLocalResolution{}
+	s.Resolvers.Chain, _ = ParseResolverChain("local")
+	if err := s.SaveProject(gopath, app.dir); err != nil {
+		t.Fatalf("SaveProject returned error %s", err.Error())
+	}
+	reader := &DepReader{Gopath: gopath}
+	saved, err := reader.IntentDependencies("test.com/app")
+	if err != nil || len(saved) != 1 || !reflect.DeepEqual(saved[0], intent[0]) {
+		t.Errorf("Expected the Canticle file entry %+v kept got %+v %v", intent[0], saved, err)
+	}
+	locked, err := reader.LockedDependencies("test.com/app")
+	if err != nil || len(locked) != 1 || locked[0].Revision != updated || locked[0].Hash != hash {
+		t.Errorf("Expected test.com/a locked to %s with hash %s got %+v %v", updated, hash, locked, err)
+	}
+	if err == nil && len(locked) == 1 && (locked[0].SourcePath != intent[0].SourcePath || !locked[0].All) {
+		t.Errorf("Expected the lock to keep the SourcePath and All of the Canticle file got %+v", locked[0])
+	}
+}
+
+func TestKeepTools(t *testing.T) {
+	gen := []string{"test.com/tools/cmd/gen"}
+	cases := []struct {
+		Name     string
+		Existing []*CanticleDependency
+		Cantdeps []*CanticleDependency
+		Expected []*CanticleDependency
+	}{
+		{
+			"declared tool not on disk is kept",
+			[]*CanticleDependency{{Root: "test.com/tools", Revision: "t1", Scope: ScopeTool, Tools: gen}},
+			[]*CanticleDependency{{Root: "test.com/a", Revision: "a1"}},
+			[]*CanticleDependency{{Root: "test.com/a", Revision: "a1"}, {Root: "test.com/tools", Revision: "t1", Scope: ScopeTool, Tools: gen}},
+		},
+		{
+			"tool already locked keeps its lock and gains its tools",
+			[]*CanticleDependency{{Root: "test.com/tools", Revision: "old", Scope: ScopeTool, Tools: gen}},
+			[]*CanticleDependency{{Root: "test.com/tools", Revision: "t2"}},
+			[]*CanticleDependency{{Root: "test.com/tools", Revision: "t2", Tools: gen}},
+		},
+		{
+			"non tool dep is not kept",
+			[]*CanticleDependency{{Root: "test.com/unused", Revision: "u1"}},
+			[]*CanticleDependency{{Root: "test.com/a", Revision: "a1"}},
+			[]*CanticleDependency{{Root: "test.com/a", Revision: "a1"}},
+		},
+	}
+	for _, c := range cases {
+		if kept := KeepTools(c.Existing, c.Cantdeps); !reflect.DeepEqual(kept, c.Expected) {
+			t.Errorf("KeepTools %s expected %+v got %+v", c.Name, c.Expected, kept)
+		}
+	}
+}
+
+func TestLockDeps(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-lock")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	tr := newTestGitRepo(t, gopath, "test.com/a")
+	tagged := tr.commit("a", "one")
+	tr.git("tag", "v1.2.0")
+	tr.git("checkout", "-q", "-b", "other")
+	branch := tr.commit("a", "two")
+	tr.git("checkout", "-q", "master")
+
+	sources := NewDependencySources(1)
+	source := NewDependencySource("test.com/a")
+	source.OnDiskRevision = "master"
+	source.OnDiskCommit = tagged
+	source.OnDiskBranch = "master"
+	sources.AddSource(source)
+
+	cases := []struct {
+		Revision string
+		Expected string
+	}{
+		{"master", tagged},
+		{"other", branch},
+		{"^1.0", tagged},
+		{branch, branch},
+	}
+	for _, c := range cases {
+		locked, err := LockDeps(gopath, sources, []*CanticleDependency{{Root: "test.com/a", Revision: c.Revision}})
+		if err != nil {
+			t.Errorf("LockDeps %s returned error %s", c.Revision, err.Error())
+			continue
+		}
+		if locked[0].Revision != c.Expected {
+			t.Errorf("LockDeps %s expected revision %s got %s", c.Revision, c.Expected, locked[0].Revision)
+		}
+		if hashed := locked[0].Hash != ""; hashed != (c.Expected == tagged) {
+			t.Errorf("LockDeps %s expected only the commit on disk hashed got %q", c.Revision, locked[0].Hash)
+		}
+	}
+	for _, rev := range []string{"nothere", "^2.0", ""} {
+		if locked, err := LockDeps(gopath, sources, []*CanticleDependency{{Root: "test.com/a", Revision: rev}}); err == nil {
+			t.Errorf("LockDeps %q returned no error locking to %s", rev, locked[0].Revision)
+		}
+	}
+	if _, err := LockDeps(gopath, sources, []*CanticleDependency{{Root: "test.com/nothere", Revision: "master"}}); err == nil {
+		t.Errorf("LockDeps returned no error for a repo not on disk")
+	}
+
+	// Uncommitted changes are warned about and not hashed
+	committed, err := HashTree(tr.dir, tagged)
+	if err != nil {
+		t.Fatalf("HashTree returned error %s", err.Error())
+	}
+	tr.write("a", "edited")
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+	locked, err := LockDeps(gopath, sources, []*CanticleDependency{{Root: "test.com/a", Revision: "master"}})
+	if err != nil || locked[0].Hash != committed {
+		t.Errorf("LockDeps of a dirty repo expected hash %s got %+v %v", committed, locked, err)
+	}
+	if !strings.Contains(out.String(), "uncommitted changes") {
+		t.Errorf("LockDeps did not warn about uncommitted changes: %s", out.String())
+	}
+}
+
+func TestCheckPushed(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-pushed")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	tr := newTestGitRepo(t, gopath, "test.com/a")
+	remote := path.Join(gopath, "remote.git")
+	tr.git("init", "-q", "--bare", remote)
+	tr.git("remote", "add", "origin", remote)
+	pushed := tr.commit("a", "one")
+	tr.git("push", "-q", "origin", "HEAD")
+	local := tr.commit("a", "two")
+
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+	cases := []struct {
+		strict bool
+		rev    string
+		err    bool
+		warn   bool
+	}{
+		{false, pushed, false, false},
+		{true, pushed, false, false},
+		{false, local, false, true},
+		{true, local, true, false},
+	}
+	for _, c := range cases {
+		out.Reset()
+		cdeps := []*CanticleDependency{{Root: "test.com/a", Revision: c.rev}, {Root: "test.com/missing", Revision: "abc"}}
+		err := (&Save{Strict: c.strict}).CheckPushed(gopath, cdeps)
+		if (err != nil) != c.err {
+			t.Errorf("CheckPushed strict %v of %s returned error %v", c.strict, c.rev, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "test.com/a "+local) {
+			t.Errorf("CheckPushed error does not list the unpushed revision: %s", err.Error())
+		}
+		if warned := strings.Contains(out.String(), "test.com/a "+local); warned != c.warn {
+			t.Errorf("CheckPushed strict %v of %s warned %v: %s", c.strict, c.rev, warned, out.String())
+		}
+	}
+}
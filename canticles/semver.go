@@ -0,0 +1,300 @@
+package canticles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Version is a semantic version parsed from a tag such as v1.4.2
+// or 2.0.0-rc.1. Build metadata is ignored.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// ParseVersion parses a tag of the form [v]major.minor.patch[-pre].
+func ParseVersion(s string) (*Version, error) {
+	v, parts, err := parsePartialVersion(s)
+	if err != nil {
+		return nil, err
+	}
+	if parts != 3 {
+		return nil, fmt.Errorf("version %q must have a major, minor and patch", s)
+	}
+	return v, nil
+}
+
+// parsePartialVersion parses a version which may be missing its
+// minor and patch, returning the number of parts present.
+func parsePartialVersion(s string) (*Version, int, error) {
+	str := strings.TrimPrefix(s, "v")
+	if i := strings.Index(str, "+"); i >= 0 {
+		str = str[:i]
+	}
+	v := &Version{}
+	if i := strings.Index(str, "-"); i >= 0 {
+		str, v.Pre = str[:i], str[i+1:]
+		if v.Pre == "" {
+			return nil, 0, fmt.Errorf("version %q has an empty prerelease", s)
+		}
+	}
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return nil, 0, fmt.Errorf("version %q has too many parts", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("version %q is not a semantic version", s)
+		}
+		*nums[i] = n
+	}
+	return v, len(parts), nil
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to or greater
+// than o. Prereleases are less than their release and compared as
+// strings.
+func (v *Version) Compare(o *Version) int {
+	for _, c := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		switch {
+		case c[0] < c[1]:
+			return -1
+		case c[0] > c[1]:
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	case v.Pre < o.Pre:
+		return -1
+	}
+	return 1
+}
+
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// A comparison is a single operator and version in a constraint.
+type comparison struct {
+	op string
+	v  *Version
+}
+
+func (c comparison) match(v *Version) bool {
+	cmp := v.Compare(c.v)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	}
+	return cmp == 0
+}
+
+func (c comparison) String() string {
+	return c.op + c.v.String()
+}
+
+// A Constraint is a set of comparisons a version must all satisfy,
+// for example ^1.4, ~2.0.3 or >=1.2 <2.
+type Constraint []comparison
+
+// IsConstraint returns true if rev is written as a version
+// constraint rather than a revision, branch or tag.
+func IsConstraint(rev string) bool {
+	return rev != "" && strings.ContainsAny(rev[:1], "^~<>=")
+}
+
+// ParseConstraint parses a space separated list of comparisons. Each
+// is one of:
+//
+//	^1.4    compatible, >=1.4.0 <2.0.0 (or <0.5.0 for ^0.4)
+//	~2.0.3  patch level, >=2.0.3 <2.1.0 (or <3.0.0 for ~2)
+//	>=1.2, >1.2, <=1.2, <2 and =1.2.3
+//
+// Missing minor and patch versions are treated as 0.
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	for _, field := range strings.Fields(s) {
+		op := ""
+		for _, o := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(field, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("constraint %q is missing an operator in %q", s, field)
+		}
+		v, parts, err := parsePartialVersion(field[len(op):])
+		if err != nil {
+			return nil, fmt.Errorf("bad constraint %q %s", s, err.Error())
+		}
+		switch op {
+		case "^":
+			upper := &Version{Major: v.Major + 1}
+			switch {
+			case v.Major == 0 && parts > 1 && (v.Minor > 0 || parts == 2):
+				upper = &Version{Minor: v.Minor + 1}
+			case v.Major == 0 && parts == 3:
+				upper = &Version{Patch: v.Patch + 1}
+			}
+			c = append(c, comparison{">=", v}, comparison{"<", upper})
+		case "~":
+			upper := &Version{Major: v.Major + 1}
+			if parts > 1 {
+				upper = &Version{Major: v.Major, Minor: v.Minor + 1}
+			}
+			c = append(c, comparison{">=", v}, comparison{"<", upper})
+		default:
+			c = append(c, comparison{op, v})
+		}
+	}
+	if len(c) == 0 {
+		return nil, fmt.Errorf("constraint %q is empty", s)
+	}
+	return c, nil
+}
+
+// Match returns true if v satisfies every comparison. Prereleases
+// only match constraints that name a prerelease of the same version.
+func (c Constraint) Match(v *Version) bool {
+	if v.Pre != "" && !c.allowsPre(v) {
+		return false
+	}
+	for _, cmp := range c {
+		if !cmp.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) allowsPre(v *Version) bool {
+	for _, cmp := range c {
+		if cmp.v.Pre != "" && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect returns a constraint matching only versions that match
+// both c and o.
+func (c Constraint) Intersect(o Constraint) Constraint {
+	return append(append(Constraint{}, c...), o...)
+}
+
+// Satisfiable returns false if no version could match c, for
+// example the intersection of ^1.2 and ^2.0.
+func (c Constraint) Satisfiable() bool {
+	var lower, upper *comparison
+	for i := range c {
+		cmp := &c[i]
+		if cmp.op == "=" {
+			return c.Match(cmp.v)
+		}
+		if strings.HasPrefix(cmp.op, ">") && (lower == nil || cmp.v.Compare(lower.v) > 0 || (cmp.v.Compare(lower.v) == 0 && cmp.op == ">")) {
+			lower = cmp
+		}
+		if strings.HasPrefix(cmp.op, "<") && (upper == nil || cmp.v.Compare(upper.v) < 0 || (cmp.v.Compare(upper.v) == 0 && cmp.op == "<")) {
+			upper = cmp
+		}
+	}
+	if lower == nil || upper == nil {
+		return true
+	}
+	switch cmp := lower.v.Compare(upper.v); {
+	case cmp < 0:
+		return true
+	case cmp == 0:
+		return lower.op == ">=" && upper.op == "<="
+	}
+	return false
+}
+
+func (c Constraint) String() string {
+	strs := make([]string, 0, len(c))
+	for _, cmp := range c {
+		strs = append(strs, cmp.String())
+	}
+	return strings.Join(strs, " ")
+}
+
+// Best returns the tag with the highest version matching c. Tags
+// which are not semantic versions are ignored.
+func (c Constraint) Best(tags []string) (string, bool) {
+	var best string
+	var bestVersion *Version
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil || !c.Match(v) {
+			continue
+		}
+		if bestVersion == nil || v.Compare(bestVersion) > 0 {
+			best, bestVersion = tag, v
+		}
+	}
+	return best, bestVersion != nil
+}
+
+// IntersectRevisions combines the version constraints in revs into a
+// single constraint. If a version tag in revs satisfies the combined
+// constraint the constraint is dropped. Constraints that can not be
+// satisfied together, and all other revisions, are returned as is so
+// they may be resolved another way.
+func IntersectRevisions(revs []string) []string {
+	var result, constraints []string
+	var combined Constraint
+	for _, rev := range revs {
+		if !IsConstraint(rev) {
+			result = append(result, rev)
+			continue
+		}
+		c, err := ParseConstraint(rev)
+		if err != nil {
+			LogWarn("Ignoring bad constraint %s", err.Error())
+			result = append(result, rev)
+			continue
+		}
+		constraints = append(constraints, rev)
+		combined = combined.Intersect(c)
+	}
+	switch {
+	case len(constraints) == 0:
+		return revs
+	case !combined.Satisfiable():
+		return append(result, constraints...)
+	}
+
+	satisfied := false
+	for _, rev := range result {
+		if v, err := ParseVersion(rev); err == nil && combined.Match(v) {
+			satisfied = true
+		}
+	}
+	if satisfied {
+		return result
+	}
+	if len(constraints) == 1 {
+		return append(result, constraints[0])
+	}
+	return append(result, combined.String())
+}
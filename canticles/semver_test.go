@@ -0,0 +1,115 @@
+package canticles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("v1.4.2-rc.1+build5")
+	if err != nil {
+		t.Fatalf("ParseVersion returned error: %s", err.Error())
+	}
+	expected := &Version{Major: 1, Minor: 4, Patch: 2, Pre: "rc.1"}
+	if !reflect.DeepEqual(expected, v) {
+		t.Errorf("ParseVersion expected %+v got %+v", expected, v)
+	}
+	for _, bad := range []string{"master", "1.4", "1.2.3.4", "1.x.0", "1.2.3-", ""} {
+		if _, err := ParseVersion(bad); err == nil {
+			t.Errorf("ParseVersion %q returned no error", bad)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	cases := []struct {
+		Constraint string
+		Match      []string
+		NoMatch    []string
+	}{
+		{"^1.4", []string{"1.4.0", "v1.9.3"}, []string{"1.3.9", "2.0.0", "1.5.0-beta"}},
+		{"^0.4", []string{"0.4.0", "0.4.7"}, []string{"0.5.0", "0.3.9"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"~2.0.3", []string{"2.0.3", "2.0.9"}, []string{"2.1.0", "2.0.2"}},
+		{"~2", []string{"2.0.0", "2.7.1"}, []string{"3.0.0", "1.9.9"}},
+		{">=1.2 <2", []string{"1.2.0", "1.99.0"}, []string{"1.1.9", "2.0.0"}},
+		{"=1.2.3-rc.1", []string{"1.2.3-rc.1"}, []string{"1.2.3"}},
+	}
+	for _, c := range cases {
+		con, err := ParseConstraint(c.Constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint %q returned error: %s", c.Constraint, err.Error())
+			continue
+		}
+		for _, tag := range c.Match {
+			if v, _ := ParseVersion(tag); !con.Match(v) {
+				t.Errorf("Constraint %s expected to match %s", c.Constraint, tag)
+			}
+		}
+		for _, tag := range c.NoMatch {
+			if v, _ := ParseVersion(tag); con.Match(v) {
+				t.Errorf("Constraint %s expected not to match %s", c.Constraint, tag)
+			}
+		}
+	}
+	for _, bad := range []string{"1.4", "^", "^a.b", " "} {
+		if _, err := ParseConstraint(bad); err == nil {
+			t.Errorf("ParseConstraint %q returned no error", bad)
+		}
+	}
+}
+
+func TestConstraintBest(t *testing.T) {
+	c, _ := ParseConstraint("^1.4")
+	tags := []string{"v1.3.0", "v1.4.0", "v1.6.2", "v1.7.0-beta", "v2.0.0", "release"}
+	if best, ok := c.Best(tags); !ok || best != "v1.6.2" {
+		t.Errorf("Best expected v1.6.2 got %s %v", best, ok)
+	}
+	c, _ = ParseConstraint("^3")
+	if best, ok := c.Best(tags); ok {
+		t.Errorf("Best expected no match got %s", best)
+	}
+}
+
+func TestConstraintSatisfiable(t *testing.T) {
+	cases := map[string]bool{
+		"^1.2 ^1.4":    true,
+		"^1.2 ^2.0":    false,
+		">=1.2 <=1.2":  true,
+		">1.2 <=1.2":   false,
+		"=1.2.3 ^1.0":  true,
+		"=1.2.3 ~1.3":  false,
+		">=1.0":        true,
+		"<2.0 >=0.1.0": true,
+	}
+	for str, expected := range cases {
+		c, err := ParseConstraint(str)
+		if err != nil {
+			t.Fatalf("ParseConstraint %q returned error: %s", str, err.Error())
+		}
+		if c.Satisfiable() != expected {
+			t.Errorf("Constraint %s expected satisfiable %v", str, expected)
+		}
+	}
+}
+
+func TestIntersectRevisions(t *testing.T) {
+	cases := []struct {
+		Revs     []string
+		Expected []string
+	}{
+		{[]string{"abc", "def"}, []string{"abc", "def"}},
+		{[]string{"^1.2"}, []string{"^1.2"}},
+		{[]string{"^1.2", "^1.4"}, []string{">=1.2.0 <2.0.0 >=1.4.0 <2.0.0"}},
+		{[]string{"^1.2", "v1.5.0"}, []string{"v1.5.0"}},
+		{[]string{"^1.2", "v2.5.0"}, []string{"v2.5.0", "^1.2"}},
+		{[]string{"^1.2", "^2.0"}, []string{"^1.2", "^2.0"}},
+		{[]string{"abc", "^1.2"}, []string{"abc", "^1.2"}},
+	}
+	for _, c := range cases {
+		result := IntersectRevisions(c.Revs)
+		if !reflect.DeepEqual(c.Expected, result) {
+			t.Errorf("IntersectRevisions %v expected %v got %v", c.Revs, c.Expected, result)
+		}
+	}
+}
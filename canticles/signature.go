@@ -0,0 +1,152 @@
+package canticles
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Signature requirements of a SignaturePolicy.
+const (
+	// SignCommit requires the checked out commit be signed.
+	SignCommit = "commit"
+	// SignTag requires the revision be a signed tag.
+	SignTag = "tag"
+)
+
+// A SignaturePolicy requires the pinned revision of a dependency be
+// signed by a trusted key. Keyring and AllowedSigners are relative
+// to the directory of the Canticle file declaring the policy, at
+// least one must be set. Signatures by any other key are refused.
+type SignaturePolicy struct {
+	// Require is SignCommit or SignTag.
+	Require string
+	// Keyring is an exported GPG public keyring (binary or armored)
+	// of keys trusted to sign.
+	Keyring string `json:",omitempty"`
+	// AllowedSigners is an ssh-keygen allowed signers file of SSH
+	// keys trusted to sign.
+	AllowedSigners string `json:",omitempty"`
+	// dir is the directory of the Canticle file read, if any
+	dir string
+}
+
+// keyPath returns p relative to the policies Canticle file.
+func (sp *SignaturePolicy) keyPath(p string) string {
+	if filepath.IsAbs(p) || sp.dir == "" {
+		return p
+	}
+	return filepath.Join(sp.dir, p)
+}
+
+// Validate returns an error if the policy can not be checked.
+func (sp *SignaturePolicy) Validate() error {
+	if sp.Require != SignCommit && sp.Require != SignTag {
+		return fmt.Errorf("signature policy must require %s or %s not %q", SignCommit, SignTag, sp.Require)
+	}
+	if sp.Keyring == "" && sp.AllowedSigners == "" {
+		return errors.New("signature policy needs a Keyring or AllowedSigners file")
+	}
+	return nil
+}
+
+// SignatureFuncs verify the revision checked out at path satisfies a
+// SignaturePolicy for each VCS which supports signatures.
+var SignatureFuncs = map[string]func(path, rev string, sp *SignaturePolicy) error{
+	GitBranchCmd.Name: VerifyGitSignature,
+}
+
+// VerifyGitSignature checks HEAD, or the tag rev, with git
+// verify-commit or verify-tag. If a tag is required and rev is not
+// one, as in a Canticle.lock, it must be a revision a tag signed by a
+// trusted key points at. GPG keys are read from a temporary
+// GNUPGHOME holding only the policies Keyring, and SSH keys only
+// from its AllowedSigners, so keys the user trusts are not trusted
+// here.
+func VerifyGitSignature(path, rev string, sp *SignaturePolicy) error {
+	if err := sp.Validate(); err != nil {
+		return err
+	}
+	gnupgHome, err := ioutil.TempDir("", "cant-gnupg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(gnupgHome)
+	env := PatchEnviroment(os.Environ(), "GNUPGHOME", gnupgHome)
+	if sp.Keyring != "" {
+		cmd := exec.Command("gpg", "--batch", "--quiet", "--import", sp.keyPath(sp.Keyring))
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("cant import keyring %s %s", sp.keyPath(sp.Keyring), strings.TrimSpace(string(out)))
+		}
+	}
+	allowed := os.DevNull
+	if sp.AllowedSigners != "" {
+		allowed = sp.keyPath(sp.AllowedSigners)
+	}
+
+	verify := func(what, name string) error {
+		cmd := exec.Command("git", "-c", "gpg.ssh.allowedSignersFile="+allowed, "verify-"+what, name)
+		cmd.Dir = path
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s %s is not signed by a trusted key: %s", what, name, strings.TrimSpace(string(out)))
+		}
+		LogVerbose("Verified signed %s %s:\n%s", what, name, string(out))
+		return nil
+	}
+	if sp.Require != SignTag {
+		return verify("commit", "HEAD")
+	}
+	cmd := exec.Command("git", "rev-parse", "-q", "--verify", "refs/tags/"+rev)
+	cmd.Dir = path
+	if err := cmd.Run(); err == nil {
+		return verify("tag", rev)
+	}
+	tags, err := outputLines(path, "git", "tag", "--points-at", rev)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("revision %s is not a tag and no tag points at it, a signed tag is required", rev)
+	}
+	for _, tag := range tags {
+		if err = verify("tag", tag); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// SignatureRepoResolver sets the SignaturePolicy of dependencies on
+// the VCSs its Resolver returns, so it is verified when they are
+// checked out.
+type SignatureRepoResolver struct {
+	Resolver RepoResolver
+}
+
+// ResolveRepo returns a copy of the resolved VCS with dep's
+// SignaturePolicy. VCSs which can not check signatures are refused
+// if dep has a policy.
+func (sr *SignatureRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	v, err := sr.Resolver.ResolveRepo(importPath, dep)
+	if err != nil || dep == nil || dep.Signature == nil {
+		return v, err
+	}
+	switch vcs := v.(type) {
+	case *LocalVCS:
+		signed := *vcs
+		signed.Signature = dep.Signature
+		return &signed, nil
+	case *PackageVCS:
+		signed := *vcs
+		signed.Signature = dep.Signature
+		return &signed, nil
+	}
+	return nil, fmt.Errorf("cant verify signatures of %s fetched with %T", dep.Root, v)
+}
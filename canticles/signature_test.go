@@ -0,0 +1,214 @@
+package canticles
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// signingRepo is a git repo with commits and tags signed by
+// locally generated SSH keys.
+type signingRepo struct {
+	*testGitRepo
+}
+
+func (sr *signingRepo) git(args ...string) string {
+	return sr.testGitRepo.git(append([]string{"-c", "gpg.format=ssh"}, args...)...)
+}
+
+// key generates an ssh key and returns its private key path and
+// allowed signers line.
+func (sr *signingRepo) key(name string) (string, string) {
+	key := path.Join(sr.gopath, name)
+	sr.run(sr.gopath, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", key)
+	pub, err := ioutil.ReadFile(key + ".pub")
+	if err != nil {
+		sr.t.Fatalf("Error reading key %s", err.Error())
+	}
+	return key, "test@test.com " + strings.TrimSpace(string(pub))
+}
+
+func (sr *signingRepo) commit(file, key string) string {
+	sr.write(file, file)
+	sr.git("add", file)
+	if key == "" {
+		sr.git("commit", "-q", "-m", file)
+	} else {
+		sr.git("-c", "user.signingkey="+key, "commit", "-q", "-S", "-m", file)
+	}
+	return sr.git("rev-parse", "HEAD")
+}
+
+func TestVerifyGitSignature(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("Can not test signatures without ssh-keygen")
+	}
+	gopath, err := ioutil.TempDir("", "cant-test-signature")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	sr := &signingRepo{newTestGitRepo(t, gopath, "test.com/signed")}
+	trusted, allowed := sr.key("trusted")
+	untrusted, _ := sr.key("untrusted")
+	if err := ioutil.WriteFile(path.Join(gopath, "allowed_signers"), []byte(allowed+"\n"), 0644); err != nil {
+		t.Fatalf("Error writing allowed signers: %s", err.Error())
+	}
+	signed := sr.commit("a", trusted)
+	sr.git("-c", "user.signingkey="+trusted, "tag", "-s", "-m", "v1", "v1.0.0")
+	sr.git("tag", "unsigned")
+	badSig := sr.commit("b", untrusted)
+	noSig := sr.commit("c", "")
+
+	commitPolicy := &SignaturePolicy{Require: SignCommit, AllowedSigners: "allowed_signers", dir: gopath}
+	tagPolicy := &SignaturePolicy{Require: SignTag, AllowedSigners: "allowed_signers", dir: gopath}
+	cases := []struct {
+		Policy *SignaturePolicy
+		Rev    string
+		OK     bool
+	}{
+		{commitPolicy, signed, true},
+		{commitPolicy, badSig, false},
+		{commitPolicy, noSig, false},
+		{tagPolicy, "v1.0.0", true},
+		{tagPolicy, "unsigned", false},
+		{tagPolicy, signed, true},
+		{tagPolicy, badSig, false},
+		{&SignaturePolicy{Require: SignCommit, dir: gopath}, signed, false},
+	}
+	lv := NewLocalVCS("test.com/signed", "test.com/signed", gopath, vcs.ByCmd("git"))
+	for _, c := range cases {
+		lv.Signature = c.Policy
+		err := lv.TagSync(c.Rev)
+		if c.OK && err != nil {
+			t.Errorf("TagSync %s with policy %+v returned error %s", c.Rev, c.Policy, err.Error())
+		}
+		if !c.OK && err == nil {
+			t.Errorf("TagSync %s with policy %+v returned no error", c.Rev, c.Policy)
+		}
+	}
+}
+
+// newSigningRepo returns a signingRepo for root in gopath, a trusted
+// and an untrusted key and an allowed_signers file in gopath trusting
+// the first.
+func newSigningRepo(t *testing.T, gopath, root string) (*signingRepo, string, string) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("Can not test signatures without ssh-keygen")
+	}
+	sr := &signingRepo{newTestGitRepo(t, gopath, root)}
+	trusted, allowed := sr.key("trusted")
+	untrusted, _ := sr.key("untrusted")
+	if err := ioutil.WriteFile(path.Join(gopath, "allowed_signers"), []byte(allowed+"\n"), 0644); err != nil {
+		t.Fatalf("Error writing allowed signers: %s", err.Error())
+	}
+	return sr, trusted, untrusted
+}
+
+func TestUpdateBranchSignature(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-signature")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	upstream, trusted, _ := newSigningRepo(t, gopath, "test.com/upstream")
+	signed := upstream.commit("a", trusted)
+	clone := PackageSource(gopath, "test.com/signed")
+	upstream.git("clone", "-q", upstream.dir, clone)
+
+	lv := NewLocalVCS("test.com/signed", "test.com/signed", gopath, vcs.ByCmd("git"))
+	lv.Signature = &SignaturePolicy{Require: SignCommit, AllowedSigners: "allowed_signers", dir: gopath}
+	next := upstream.commit("b", trusted)
+	if updated, res, err := lv.UpdateBranch("master"); err != nil || !updated {
+		t.Errorf("UpdateBranch to a signed commit returned %v %s %v", updated, res, err)
+	}
+	if rev, _ := lv.GetRev(); rev != next {
+		t.Errorf("Expected update to signed %s from %s got %s", next, signed, rev)
+	}
+	upstream.commit("c", "")
+	if updated, _, err := lv.UpdateBranch("master"); err == nil || updated {
+		t.Errorf("UpdateBranch to an unsigned commit returned %v %v", updated, err)
+	}
+}
+
+// TestSignedTagLock saves a dependency with a tag policy into a
+// Canticle.lock, which records its commit, and gets it back.
+func TestSignedTagLock(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-signature")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	Offline = true
+	defer func() { Offline = false }()
+	dep, trusted, _ := newSigningRepo(t, gopath, "test.com/signed")
+	dep.write("signed.go", "package signed\n")
+	dep.git("add", "signed.go")
+	dep.git("-c", "user.signingkey="+trusted, "commit", "-q", "-S", "-m", "signed")
+	tagged := dep.git("rev-parse", "HEAD")
+	dep.git("-c", "user.signingkey="+trusted, "tag", "-s", "-m", "v1", "v1.0.0")
+
+	app := newTestGitRepo(t, gopath, "test.com/app")
+	app.write("app.go", "package app\n\nimport _ \"test.com/signed\"\n")
+	policy := &SignaturePolicy{Require: SignTag, AllowedSigners: "../../../allowed_signers"}
+	cdeps := []*CanticleDependency{{Root: "test.com/signed", Revision: "v1.0.0", Signature: policy}}
+	if err := WriteCanticleFile(DependencyFile(app.dir), NewCanticleFile("test.com/app", cdeps)); err != nil {
+		t.Fatalf("Error writing Canticle file: %s", err.Error())
+	}
+	app.git("add", ".")
+	app.git("commit", "-q", "-m", "app")
+
+	s := NewSave()
+	s.Resolver = &PreferLocalResolution{}
+	s.Resolvers.Chain, _ = ParseResolverChain("local")
+	if err := s.SaveProject(gopath, app.dir); err != nil {
+		t.Fatalf("SaveProject returned error %s", err.Error())
+	}
+	locked, err := (&DepReader{Gopath: gopath}).LockedDependencies("test.com/app")
+	if err != nil || len(locked) != 1 || locked[0].Revision != tagged || locked[0].Signature == nil {
+		t.Fatalf("Expected %s locked with its policy got %+v %v", tagged, locked, err)
+	}
+
+	dep.commit("later", "")
+	loader := &CanticleDepLoader{
+		Reader:   &DepReader{Gopath: gopath},
+		Resolver: &SignatureRepoResolver{&LocalRepoResolver{LocalPath: gopath}},
+		Gopath:   gopath,
+	}
+	if errs := loader.FetchPath(app.dir); len(errs) > 0 {
+		t.Fatalf("FetchPath of the saved lock returned errors %v", errs)
+	}
+	if rev := dep.git("rev-parse", "HEAD"); rev != tagged {
+		t.Errorf("Expected get to check out %s got %s", tagged, rev)
+	}
+
+	dep.git("tag", "-d", "v1.0.0")
+	dep.git("checkout", "-q", "master")
+	if errs := loader.FetchPath(app.dir); len(errs) == 0 {
+		t.Errorf("FetchPath returned no error for a lock without a signed tag")
+	}
+}
+
+func TestSignatureRepoResolver(t *testing.T) {
+	lv := &LocalVCS{Root: "test.com/a"}
+	policy := &SignaturePolicy{Require: SignTag, Keyring: "keys.gpg"}
+	sr := &SignatureRepoResolver{&testResolver{response: []resolve{{v: lv}, {v: lv}, {v: &ArchiveVCS{}}}}}
+	v, err := sr.ResolveRepo("test.com/a", &CanticleDependency{Root: "test.com/a", Signature: policy})
+	if err != nil {
+		t.Fatalf("SignatureRepoResolver returned error %s", err.Error())
+	}
+	if v.(*LocalVCS).Signature != policy || lv.Signature != nil {
+		t.Errorf("SignatureRepoResolver did not set policy on a copy of the vcs")
+	}
+	if v, _ := sr.ResolveRepo("test.com/a", nil); v != lv {
+		t.Errorf("SignatureRepoResolver modified vcs without a policy")
+	}
+	if _, err := sr.ResolveRepo("test.com/a", &CanticleDependency{Root: "test.com/a", Signature: policy}); err == nil {
+		t.Errorf("SignatureRepoResolver returned no error for a vcs without signatures")
+	}
+}
@@ -0,0 +1,163 @@
+package canticles
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type Tools struct {
+	flags     *flag.FlagSet
+	Verbose   bool
+	Bin       string
+	Resolvers ResolverFlags
+	// Install installs pkgs into bin, GoInstall by default.
+	Install func(gopath, bin string, pkgs ...string) error
+}
+
+func NewTools() *Tools {
+	f := flag.NewFlagSet("tools", flag.ExitOnError)
+	t := &Tools{flags: f, Install: GoInstall}
+	f.BoolVar(&t.Verbose, "v", false, "Be verbose when installing tools")
+	f.StringVar(&t.Bin, "bin", "bin", "Install tools into this directory, relative to the project")
+	t.Resolvers.Register(f, "local,remote,default")
+	return t
+}
+
+var tools = NewTools()
+
+var ToolsCommand = &Command{
+	Name:             "tools",
+	UsageLine:        "tools install [-v] [-bin <dir>] [-resolvers <list>] [tool...]",
+	ShortDescription: "Fetch and install the tools pinned in the Canticle file.",
+	LongDescription: `The tools command manages the tool dependencies of a project, commands such as code generators that are needed to build or develop it but are not imported.
+
+Tools are declared in the Canticle file by listing the import paths of their main packages in the Tools field of a dependency, with the scope tool:
+
+    {
+        "Root": "golang.org/x/tools",
+        "Revision": "2ae76fd1560b622911f444c1e66b70a857e1e67c",
+        "Scope": "tool",
+        "Tools": ["golang.org/x/tools/cmd/stringer"]
+    }
+
+Save keeps declared tools when it rewrites the Canticle file.
+
+tools install fetches each tool dependency at its pinned revision, using the same resolvers as get, and runs go install for its tools with GOBIN set to the projects bin directory. Specify tool import paths or command names to install only those tools.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -bin to install into a different directory, relative paths are relative to the project.`,
+	Flags: tools.flags,
+	Cmd:   tools,
+}
+
+// Run the tools command. The first argument is the subcommand, flags
+// may be given before or after it.
+func (t *Tools) Run(args []string) {
+	args = t.flags.Args()
+	if len(args) == 0 || args[0] != "install" {
+		ToolsCommand.Usage()
+	}
+	t.flags.Parse(args[1:])
+	if t.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gopath, err := EnvGoPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := t.InstallTools(gopath, wd, t.flags.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// InstallTools fetches the tool dependencies in the Canticle file in
+// dir and installs their tools into the bin directory. If names is
+// not empty only tools whose import path or command name is in names
+// are installed.
+func (t *Tools) InstallTools(gopath, dir string, names []string) error {
+	pkg, err := PackageName(gopath, dir)
+	if err != nil {
+		return err
+	}
+	reader := &DepReader{Gopath: gopath}
+	cdeps, err := reader.CanticleDependencies(pkg)
+	if err != nil {
+		return fmt.Errorf("cant read Canticle file for %s %s", pkg, err.Error())
+	}
+	resolver, err := t.Resolvers.Resolver(gopath)
+	if err != nil {
+		return err
+	}
+	bin := t.Bin
+	if !filepath.IsAbs(bin) {
+		bin = filepath.Join(dir, bin)
+	}
+
+	wanted := NewStringSet()
+	wanted.Add(names...)
+	installed := NewStringSet()
+	for _, cdep := range cdeps {
+		var install []string
+		for _, tool := range cdep.Tools {
+			if wanted.Size() == 0 || wanted[tool] || wanted[path.Base(tool)] {
+				install = append(install, tool)
+			}
+		}
+		if len(install) == 0 {
+			continue
+		}
+		if _, err := FetchDep(resolver, cdep, false); err != nil {
+			return err
+		}
+		// Fetch anything the tools import that is missing, tools
+		// are built so their tests are not needed
+		reader := &DepReader{Gopath: gopath, Scopes: NewStringSet()}
+		reader.Scopes.Add(ScopeRuntime)
+		for _, tool := range install {
+			dl := NewDependencyLoader(resolver, reader.AllDeps, cdeps, gopath)
+			dw := NewDependencyWalker(dl.PackageImports, dl.FetchUpdatePackage)
+			if err := dw.TraverseDependencies(tool); err != nil {
+				return fmt.Errorf("cant fetch dependencies of tool %s %s", tool, err.Error())
+			}
+		}
+		if err := t.Install(gopath, bin, install...); err != nil {
+			return err
+		}
+		for _, tool := range install {
+			LogInfo("Installed %s at %s into %s", tool, cdep.Revision, bin)
+			installed.Add(tool, path.Base(tool))
+		}
+	}
+	for name := range wanted {
+		if !installed[name] {
+			return fmt.Errorf("cant install tool %s, it is not declared in the Canticle file", name)
+		}
+	}
+	return nil
+}
+
+// GoInstall runs go install for pkgs in gopath with GOBIN set to bin.
+func GoInstall(gopath, bin string, pkgs ...string) error {
+	args := append([]string{"install"}, pkgs...)
+	cmd := exec.Command("go", args...)
+	LogVerbose("Running command go %s", strings.Join(args, " "))
+	env := PatchEnviroment(os.Environ(), "GOPATH", gopath)
+	cmd.Env = PatchEnviroment(env, "GOBIN", bin)
+	if result, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cant install %s %s", strings.Join(pkgs, " "), string(result))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package canticles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInstallTools(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-tools")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	Offline = true
+	defer func() { Offline = false }()
+	tr := newTestGitRepo(t, gopath, "test.com/tools")
+	pinned := tr.commit("cmd/gen/main.go", "package main\n\nfunc main() {}\n")
+	tr.commit("cmd/gen/main.go", "package main\n\n// newer\nfunc main() {}\n")
+	tr.commit("cmd/lint/main.go", "package main\n\nfunc main() {}\n")
+
+	project := PackageSource(gopath, "test.com/project")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatalf("Error creating project dir: %s", err.Error())
+	}
+	cdeps := []*CanticleDependency{
+		{Root: "test.com/tools", Revision: pinned, Scope: ScopeTool, Tools: []string{"test.com/tools/cmd/gen"}},
+		{Root: "test.com/lib", Revision: "abc"},
+	}
+	if err := WriteCanticleFile(DependencyFile(project), NewCanticleFile("test.com/project", cdeps)); err != nil {
+		t.Fatalf("Error writing Canticle file: %s", err.Error())
+	}
+
+	var installed []string
+	var bins []string
+	tl := NewTools()
+	tl.Resolvers.Chain, _ = ParseResolverChain("local")
+	tl.Install = func(gopath, bin string, pkgs ...string) error {
+		installed = append(installed, pkgs...)
+		bins = append(bins, bin)
+		return nil
+	}
+	if err := tl.InstallTools(gopath, project, []string{"gen"}); err != nil {
+		t.Fatalf("InstallTools returned error %s", err.Error())
+	}
+	if expected := []string{"test.com/tools/cmd/gen"}; !reflect.DeepEqual(installed, expected) {
+		t.Errorf("InstallTools expected to install %v got %v", expected, installed)
+	}
+	if expected := []string{filepath.Join(project, "bin")}; !reflect.DeepEqual(bins, expected) {
+		t.Errorf("InstallTools expected to install into %v got %v", expected, bins)
+	}
+	if rev := tr.git("rev-parse", "HEAD"); rev != pinned {
+		t.Errorf("InstallTools expected tool repo at pinned %s got %s", pinned, rev)
+	}
+
+	installed = nil
+	if err := tl.InstallTools(gopath, project, []string{"lint"}); err == nil {
+		t.Errorf("InstallTools returned no error for an undeclared tool")
+	}
+	if len(installed) != 0 {
+		t.Errorf("InstallTools installed %v for an undeclared tool", installed)
+	}
+}
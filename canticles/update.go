@@ -0,0 +1,160 @@
+package canticles
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+type Update struct {
+	flags     *flag.FlagSet
+	Verbose   bool
+	DryRun    bool
+	Resolvers ResolverFlags
+}
+
+func NewUpdate() *Update {
+	f := flag.NewFlagSet("update", flag.ExitOnError)
+	u := &Update{flags: f}
+	f.BoolVar(&u.Verbose, "v", false, "Be verbose when updating stuff")
+	f.BoolVar(&u.DryRun, "d", false, "Don't save the lock, just print it.")
+	u.Resolvers.Register(f, "local,remote,default")
+	return u
+}
+
+var updateLock = NewUpdate()
+
+var UpdateCommand = &Command{
+	Name:             "update",
+	UsageLine:        "update [-v] [-d] [-resolvers <list>] [-no-cache] [-refresh-cache] [-cache-ttl <duration>] [root...]",
+	ShortDescription: "Resolve the Canticle file into a new Canticle.lock.",
+	LongDescription: `The update command resolves the branches, tags and revisions wanted by the Canticle file of the current project into exact revisions and saves them in its Canticle.lock. Each dependency is fetched, checked out at its wanted revision and, if that is a branch, updated from its remote before its revision is locked. Version constraints, such as ^1.4, are resolved to the revision of the highest matching tag. Dependencies in the lock but not in the Canticle file are left as locked.
+
+Specify roots to only update those dependencies.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -d to print the new lock instead of saving it.
+
+Specify -resolvers, -no-cache, -refresh-cache and -cache-ttl as with get.`,
+	Flags: updateLock.flags,
+	Cmd:   updateLock,
+}
+
+// Run the update command.
+func (u *Update) Run(args []string) {
+	if u.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gopath, err := EnvGoPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := u.UpdateProject(gopath, wd, u.flags.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// UpdateProject resolves the Canticle file in path into its
+// Canticle.lock. If roots is not empty only those deps are resolved.
+func (u *Update) UpdateProject(gopath, path string, roots []string) error {
+	pkg, err := PackageName(gopath, path)
+	if err != nil {
+		return err
+	}
+	reader := &DepReader{Gopath: gopath}
+	intent, err := reader.IntentDependencies(pkg)
+	if err != nil {
+		return fmt.Errorf("cant update %s without a Canticle file %s", pkg, err.Error())
+	}
+	locked, err := reader.LockedDependencies(pkg)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cant read Canticle.lock %s", err.Error())
+	}
+	resolver, err := u.Resolvers.Resolver(gopath)
+	if err != nil {
+		return err
+	}
+
+	only := NewStringSet()
+	only.Add(roots...)
+	lock := make(map[string]*CanticleDependency, len(locked))
+	for _, cdep := range locked {
+		lock[cdep.Root] = cdep
+	}
+	for _, cdep := range intent {
+		if only.Size() > 0 && !only[cdep.Root] {
+			continue
+		}
+		only.Remove(cdep.Root)
+		resolved, err := ResolveLock(resolver, gopath, cdep)
+		if err != nil {
+			return err
+		}
+		if old := lock[cdep.Root]; old == nil || old.Revision != resolved.Revision {
+			from := "unlocked"
+			if old != nil {
+				from = old.Revision
+			}
+			fmt.Printf("%s: %s -> %s\n", cdep.Root, from, resolved.Revision)
+		}
+		lock[cdep.Root] = resolved
+	}
+	if only.Size() > 0 {
+		return fmt.Errorf("cant update %v, not in the Canticle file", only.Array())
+	}
+
+	deps := make([]*CanticleDependency, 0, len(lock))
+	for _, cdep := range lock {
+		deps = append(deps, cdep)
+	}
+	cf := NewCanticleFile(pkg, deps)
+	if u.DryRun {
+		b, err := cf.Marshal()
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+		return nil
+	}
+	return WriteCanticleFile(LockFile(path), cf)
+}
+
+// ResolveLock fetches cdep at its wanted revision, updating it if
+// that is a branch, and returns a copy of cdep locked to the
+// resulting revision, branch and tree hash.
+func ResolveLock(resolver RepoResolver, gopath string, cdep *CanticleDependency) (*CanticleDependency, error) {
+	if _, err := FetchDep(resolver, cdep, cdep.Revision != ""); err != nil {
+		return nil, err
+	}
+	// Remote VCSs can not report revisions, so read the repo we
+	// just fetched from disk
+	local := &LocalRepoResolver{LocalPath: gopath}
+	v, err := local.ResolveRepo(cdep.Root, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cant lock %s %s", cdep.Root, err.Error())
+	}
+	rev, err := v.GetRev()
+	if err != nil {
+		return nil, fmt.Errorf("cant get revision of %s %s", cdep.Root, err.Error())
+	}
+	hash, err := HashTree(PackageSource(gopath, cdep.Root), rev)
+	if err != nil {
+		return nil, fmt.Errorf("cant hash %s %s", cdep.Root, err.Error())
+	}
+	lock := *cdep
+	lock.Revision = rev
+	lock.Hash = hash
+	lock.Branch = ""
+	if branch, err := v.GetBranch(); err == nil {
+		lock.Branch = branch
+	}
+	return &lock, nil
+}
@@ -97,6 +97,12 @@ func EnvGoPath() (string, error) {
 	}
 	root := ProjectRoot(wd)
 	if root != "" {
+		// Keep the whole GOPATH list if root is one of its entries
+		for _, entry := range filepath.SplitList(gopath) {
+			if filepath.Clean(entry) == root {
+				return gopath, nil
+			}
+		}
 		return root, nil
 	}
 	if gopath != "" {
@@ -106,6 +112,24 @@ func EnvGoPath() (string, error) {
 	return "", fmt.Errorf("no gopath set and working directory %s is not inside a 'src/' directory", wd)
 }
 
+// DestGoPath returns the absolute path of dest, a GOPATH to fetch
+// into other than gopath, creating its src directory.
+func DestGoPath(gopath, dest string) (string, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return "", fmt.Errorf("cant use destination %s %s", dest, err.Error())
+	}
+	for _, entry := range filepath.SplitList(gopath) {
+		if dest == filepath.Clean(entry) {
+			return "", fmt.Errorf("cant use destination %s, it is in the current GOPATH", dest)
+		}
+	}
+	if err := os.MkdirAll(PackageSource(dest, ""), 0755); err != nil {
+		return "", fmt.Errorf("cant create destination %s %s", dest, err.Error())
+	}
+	return dest, nil
+}
+
 // PathIsChild will return true if the child path
 // is a subfolder of parent.
 func PathIsChild(parent, child string) bool {
@@ -122,16 +146,60 @@ func PathIsChild(parent, child string) bool {
 	return true
 }
 
-// PackageSource returns the src dir for a package
+// FetchGoPath, if it is an entry of a GOPATH list, is the entry new
+// packages are fetched into instead of the first.
+var FetchGoPath = ""
+
+// FetchEntry returns the entry of the GOPATH list gopath new packages
+// are fetched into, see FetchGoPath.
+func FetchEntry(gopath string) string {
+	entries := filepath.SplitList(gopath)
+	if len(entries) == 0 {
+		return gopath
+	}
+	for _, entry := range entries {
+		if FetchGoPath != "" && filepath.Clean(entry) == filepath.Clean(FetchGoPath) {
+			return entry
+		}
+	}
+	return entries[0]
+}
+
+// GoPathEntry returns the entry of the GOPATH list gopath which dir
+// is under, or the FetchEntry if none are.
+func GoPathEntry(gopath, dir string) string {
+	for _, entry := range filepath.SplitList(gopath) {
+		rel, err := filepath.Rel(entry, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return entry
+		}
+	}
+	return FetchEntry(gopath)
+}
+
+// PackageSource returns the src dir for a package. If gopath is a
+// list the dir in the first entry it exists in is returned, or if it
+// is in none the dir in the FetchEntry.
 func PackageSource(gopath, pkg string) string {
-	return path.Join(gopath, "src", filepath.FromSlash(pkg))
+	entries := filepath.SplitList(gopath)
+	if len(entries) < 2 {
+		return path.Join(gopath, "src", filepath.FromSlash(pkg))
+	}
+	for _, entry := range entries {
+		dir := path.Join(entry, "src", filepath.FromSlash(pkg))
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return path.Join(FetchEntry(gopath), "src", filepath.FromSlash(pkg))
 }
 
 // PackageName returns the package name (importpath) of a path given a
-// path relative to a gopath. If path is not filepath.Rel to gopath an
-// error will be returned.
+// path relative to a gopath, or the entry of a gopath list it is
+// under. If path is not filepath.Rel to gopath an error will be
+// returned.
 func PackageName(gopath, path string) (string, error) {
-	path, err := filepath.Rel(gopath, path)
+	path, err := filepath.Rel(GoPathEntry(gopath, path), path)
 	if err != nil {
 		return "", err
 	}
@@ -271,6 +339,12 @@ func DependencyFile(p string) string {
 	return path.Join(p, "Canticle")
 }
 
+// LockFile returns the location of the lock file for a path. Should
+// be a directory.
+func LockFile(p string) string {
+	return path.Join(p, "Canticle.lock")
+}
+
 func VisibleSubDirectories(dirname string) ([]string, error) {
 	finfos, err := ioutil.ReadDir(dirname)
 	subdirs := make([]string, 0, len(finfos))
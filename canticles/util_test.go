@@ -91,3 +91,33 @@ func TestEnvGoPath(t *testing.T) {
 		t.Errorf("Expected an error when getting envgopath in an valid workspace, got")
 	}
 }
+
+func TestGoPathList(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-gopaths")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	a, b := filepath.Join(testHome, "a"), filepath.Join(testHome, "b")
+	if err := os.MkdirAll(filepath.Join(b, "src", "test.com", "b"), 0755); err != nil {
+		t.Fatalf("Error creating tempdir sub folders: %s", err.Error())
+	}
+	gopath := a + string(filepath.ListSeparator) + b
+
+	if dir := PackageSource(gopath, "test.com/b"); dir != filepath.Join(b, "src", "test.com", "b") {
+		t.Errorf("PackageSource expected package in second entry got %s", dir)
+	}
+	if dir := PackageSource(gopath, "test.com/new"); dir != filepath.Join(a, "src", "test.com", "new") {
+		t.Errorf("PackageSource expected new package in first entry got %s", dir)
+	}
+	FetchGoPath = b
+	if dir := PackageSource(gopath, "test.com/new"); dir != filepath.Join(b, "src", "test.com", "new") {
+		t.Errorf("PackageSource expected new package in FetchGoPath got %s", dir)
+	}
+	FetchGoPath = ""
+	for _, dir := range []string{filepath.Join(a, "src", "test.com", "a"), filepath.Join(b, "src", "test.com", "a")} {
+		if pkg, err := PackageName(gopath, dir); err != nil || pkg != "test.com/a" {
+			t.Errorf("PackageName of %s expected test.com/a got %s %v", dir, pkg, err)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package canticles
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -39,16 +41,89 @@ func GitAtVCS() *vcs.Cmd {
 	return v
 }
 
-// A VCSCmd is used to run a VCS command for a repo
+// Offline prevents any RepoResolver or VCSCmd from accessing the
+// network. Operations that would are failed with an OfflineError.
+var Offline = false
+
+// An OfflineError is returned by operations which would access the
+// network while Offline is true.
+type OfflineError struct {
+	Op string
+}
+
+// Error message for the refused operation.
+func (oe *OfflineError) Error() string {
+	return fmt.Sprintf("cant %s in offline mode", oe.Op)
+}
+
+// IsOffline returns true if err is an OfflineError.
+func IsOffline(err error) bool {
+	_, ok := err.(*OfflineError)
+	return ok
+}
+
+// A DirtyPolicy controls what a LocalVCS does with uncommitted
+// changes and untracked files before changing the checked out
+// revision.
+type DirtyPolicy string
+
+const (
+	// DirtyRefuse fails with a DirtyError.
+	DirtyRefuse DirtyPolicy = "refuse"
+	// DirtyStash stashes the changes using StashFuncs first.
+	DirtyStash DirtyPolicy = "stash"
+	// DirtyForce changes the revision anyway, the VCS may carry the
+	// changes over or fail.
+	DirtyForce DirtyPolicy = "force"
+)
+
+// Dirty is the DirtyPolicy of any LocalVCS without its own.
+var Dirty = DirtyRefuse
+
+// ParseDirtyPolicy returns the DirtyPolicy named s.
+func ParseDirtyPolicy(s string) (DirtyPolicy, error) {
+	switch p := DirtyPolicy(s); p {
+	case DirtyRefuse, DirtyStash, DirtyForce:
+		return p, nil
+	}
+	return "", fmt.Errorf("cant use dirty policy %s, must be one of refuse, stash or force", s)
+}
+
+// A DirtyError is returned when a repo with uncommitted changes would
+// have its revision changed under DirtyRefuse.
+type DirtyError struct {
+	Root    string
+	Dir     string
+	Changes []string
+}
+
+// Error message listing the repo and its number of changes.
+func (de *DirtyError) Error() string {
+	return fmt.Sprintf("cant change revision of %s, %s has %d uncommitted changes, commit them or use -dirty stash or -dirty force",
+		de.Root, de.Dir, len(de.Changes))
+}
+
+// IsDirty returns true if err is a DirtyError.
+func IsDirty(err error) bool {
+	_, ok := err.(*DirtyError)
+	return ok
+}
+
+// A VCSCmd is used to run a VCS command for a repo. Remote commands
+// access the network and will not be run while Offline.
 type VCSCmd struct {
 	Name       string
 	Cmd        string
 	Args       []string
 	ParseRegex *regexp.Regexp
+	Remote     bool
 }
 
 // ExecWithArgs overriden from the default
 func (vc *VCSCmd) ExecWithArgs(repo string, args []string) (string, error) {
+	if vc.Remote && Offline {
+		return "", &OfflineError{fmt.Sprintf("run %s %s", vc.Cmd, strings.Join(args, " "))}
+	}
 	LogVerbose("Running command: %s %v in dir %s", vc.Cmd, args, repo)
 	cmd := exec.Command(vc.Cmd, args...)
 	cmd.Dir = repo
@@ -130,6 +205,45 @@ var (
 		HgRevCmd.Name:  HgRevCmd,
 	}
 
+	// GitCommitCmd resolves a revision of a git repo to its commit.
+	GitCommitCmd = &VCSCmd{
+		Name:       "Git",
+		Cmd:        "git",
+		Args:       []string{"rev-parse", "--verify", "{rev}^{commit}"},
+		ParseRegex: regexp.MustCompile(`^([0-9a-f]{40,64})$`),
+	}
+	// SvnCommitCmd resolves a revision of a svn repo to the last
+	// revision it changed in.
+	SvnCommitCmd = &VCSCmd{
+		Name:       "Subversion",
+		Cmd:        "svn",
+		Args:       []string{"info", "-r", "{rev}", "--show-item", "last-changed-revision"},
+		ParseRegex: regexp.MustCompile(`^(\d+)$`),
+	}
+	// BzrCommitCmd resolves a revision of a Bazaar repo to its revno.
+	BzrCommitCmd = &VCSCmd{
+		Name:       "Bazaar",
+		Cmd:        "bzr",
+		Args:       []string{"revno", "-r", "{rev}"},
+		ParseRegex: regexp.MustCompile(`^(\d+)$`),
+	}
+	// HgCommitCmd resolves a revision of a Mercurial repo to its
+	// node.
+	HgCommitCmd = &VCSCmd{
+		Name:       "Mercurial",
+		Cmd:        "hg",
+		Args:       []string{"log", "-r", "{rev}", "--template", "{node}"},
+		ParseRegex: regexp.MustCompile(`^([0-9a-f]{40})$`),
+	}
+	// CommitCmds is a map of cmd (git, svn, etc.) to the cmd to
+	// resolve a branch, tag or revision to an exact revision.
+	CommitCmds = map[string]*VCSCmd{
+		GitCommitCmd.Name: GitCommitCmd,
+		SvnCommitCmd.Name: SvnCommitCmd,
+		BzrCommitCmd.Name: BzrCommitCmd,
+		HgCommitCmd.Name:  HgCommitCmd,
+	}
+
 	// GitRemoteCmd attempts to pull the origin of a git repo.
 	GitRemoteCmd = &VCSCmd{
 		Name:       "Git",
@@ -207,6 +321,7 @@ var (
 		Cmd:        "git",
 		Args:       []string{"fetch", "--all"},
 		ParseRegex: regexp.MustCompile(`(.+)`),
+		Remote:     true,
 	}
 	// HgUpdateCmd is used used to update local copy's of remote branches (if present)
 	HgUpdateCmd = &VCSCmd{
@@ -214,6 +329,7 @@ var (
 		Cmd:        "hg",
 		Args:       []string{"pull"},
 		ParseRegex: regexp.MustCompile(`(.+)`),
+		Remote:     true,
 	}
 	// BranchCmds is a map of cmd (git, svn, etc.) to
 	// the cmd to parse the current branch
@@ -242,12 +358,14 @@ var (
 		Cmd:        "bzr",
 		Args:       []string{"update", "-r", "{tag}"},
 		ParseRegex: regexp.MustCompile(`(Updated to .+|Tree is up)$`),
+		Remote:     true,
 	}
 	SvnTagSyncCmd = &VCSCmd{
 		Name:       "Subversion",
 		Cmd:        "svn",
 		Args:       []string{"update", "--accept", "postpone", "-r", "{tag}"},
 		ParseRegex: regexp.MustCompile(`(Updated to .+|At revision)`),
+		Remote:     true,
 	}
 	TagSyncCmds = map[string]*VCSCmd{
 		GitTagSyncCmd.Name: GitTagSyncCmd,
@@ -267,12 +385,14 @@ var (
 		Cmd:        "git",
 		Args:       []string{"pull", "--ff-only", "origin", "{branch}"},
 		ParseRegex: regexp.MustCompile(`(Already|Updating .+)`),
+		Remote:     true,
 	}
 	HgBranchUpdateCmd = &VCSCmd{
 		Name:       "Mercurial",
 		Cmd:        "hg",
 		Args:       []string{"pull", "-u"},
 		ParseRegex: regexp.MustCompile(`(added .+|no changes found)$`),
+		Remote:     true,
 	}
 	BranchUpdateCmds = map[string]*VCSCmd{
 		GitBranchUpdateCmd.Name: GitBranchUpdateCmd,
@@ -286,6 +406,36 @@ var (
 		BzrTagSyncCmd.Name:      regexp.MustCompile(`(Updated to .+)`),
 		SvnTagSyncCmd.Name:      regexp.MustCompile(`(Updated to .+)`),
 	}
+
+	// GitRevDateCmd returns the unix commit time of {rev}.
+	GitRevDateCmd = &VCSCmd{
+		Name:       "Git",
+		Cmd:        "git",
+		Args:       []string{"log", "-1", "--format=%ct", "{rev}", "--"},
+		ParseRegex: regexp.MustCompile(`^(\d+)`),
+	}
+	// HgRevDateCmd returns the unix commit time of {rev}.
+	HgRevDateCmd = &VCSCmd{
+		Name:       "Mercurial",
+		Cmd:        "hg",
+		Args:       []string{"log", "-r", "{rev}", "--template", "{date|hgdate}"},
+		ParseRegex: regexp.MustCompile(`^(\d+)`),
+	}
+	RevDateCmds = map[string]*VCSCmd{
+		GitRevDateCmd.Name: GitRevDateCmd,
+		HgRevDateCmd.Name:  HgRevDateCmd,
+	}
+	// GitAheadCmd counts the commits in {rev} which are not in
+	// {base}, if 0 {rev} is an ancestor of {base}.
+	GitAheadCmd = &VCSCmd{
+		Name:       "Git",
+		Cmd:        "git",
+		Args:       []string{"rev-list", "--count", "{base}..{rev}"},
+		ParseRegex: regexp.MustCompile(`^(\d+)`),
+	}
+	AheadCmds = map[string]*VCSCmd{
+		GitAheadCmd.Name: GitAheadCmd,
+	}
 )
 
 func GetSvnBranches(path string) ([]string, error) {
@@ -326,21 +476,288 @@ func GetBzrBranches(path string) ([]string, error) {
 	return nil, errors.New("Not implemented")
 }
 
-var BranchFuncs = map[string]func(string) ([]string, error){
-	GitBranchCmd.Name: GetGitBranches,
-	SvnBranchCmd.Name: GetSvnBranches,
-	HgBranchCmd.Name:  GetHgBranches,
-	BzrBranchCmd.Name: GetBzrBranches,
+func GetGitTags(path string) ([]string, error) {
+	cmd := exec.Command("git", "tag", "-l")
+	cmd.Dir = path
+	result, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(result)), nil
+}
+
+// GetHgTags and GetBzrTags parse the tag name from the first field of
+// each line of output.
+func GetHgTags(path string) ([]string, error) {
+	return firstFields(path, "hg", "tags")
+}
+
+func GetBzrTags(path string) ([]string, error) {
+	return firstFields(path, "bzr", "tags")
+}
+
+func GetSvnTags(path string) ([]string, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func firstFields(path, name string, args ...string) ([]string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = path
+	result, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, line := range strings.Split(string(result), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] != "tip" {
+			results = append(results, fields[0])
+		}
+	}
+	return results, nil
+}
+
+// RefFuncs list the branches and tags of a repo, tags are used to
+// resolve version constraints.
+type RefFuncs struct {
+	Branches func(string) ([]string, error)
+	Tags     func(string) ([]string, error)
+}
+
+var BranchFuncs = map[string]RefFuncs{
+	GitBranchCmd.Name: {GetGitBranches, GetGitTags},
+	SvnBranchCmd.Name: {GetSvnBranches, GetSvnTags},
+	HgBranchCmd.Name:  {GetHgBranches, GetHgTags},
+	BzrBranchCmd.Name: {GetBzrBranches, GetBzrTags},
+}
+
+// outputLines runs name in path and returns the non empty lines of
+// its output.
+func outputLines(path, name string, args ...string) ([]string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = path
+	result, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed %s", name, strings.Join(args, " "), strings.TrimSpace(string(result)))
+	}
+	var lines []string
+	for _, line := range strings.Split(string(result), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// GetGitChanges, GetSvnChanges, GetHgChanges and GetBzrChanges list
+// the modified and untracked files in a working tree.
+func GetGitChanges(path string) ([]string, error) {
+	return outputLines(path, "git", "status", "--porcelain")
+}
+
+func GetSvnChanges(path string) ([]string, error) {
+	return outputLines(path, "svn", "status")
+}
+
+func GetHgChanges(path string) ([]string, error) {
+	return outputLines(path, "hg", "status")
+}
+
+func GetBzrChanges(path string) ([]string, error) {
+	return outputLines(path, "bzr", "status", "--short")
+}
+
+// ChangeFuncs list the uncommitted changes in the working tree of a
+// repo.
+var ChangeFuncs = map[string]func(string) ([]string, error){
+	GitBranchCmd.Name: GetGitChanges,
+	SvnBranchCmd.Name: GetSvnChanges,
+	HgBranchCmd.Name:  GetHgChanges,
+	BzrBranchCmd.Name: GetBzrChanges,
+}
+
+// StashGitChanges, StashHgChanges and StashBzrChanges set aside the
+// uncommitted changes in a working tree with message. Untracked files
+// are only included for git and hg.
+func StashGitChanges(path, message string) error {
+	_, err := outputLines(path, "git", "stash", "save", "--include-untracked", message)
+	return err
+}
+
+func StashHgChanges(path, message string) error {
+	_, err := outputLines(path, "hg", "--config", "extensions.shelve=", "shelve", "--addremove", "-m", message)
+	return err
+}
+
+func StashBzrChanges(path, message string) error {
+	_, err := outputLines(path, "bzr", "shelve", "--all", "-m", message)
+	return err
+}
+
+// StashFuncs stash the uncommitted changes of a repo, svn has no
+// stash.
+var StashFuncs = map[string]func(path, message string) error{
+	GitBranchCmd.Name: StashGitChanges,
+	HgBranchCmd.Name:  StashHgChanges,
+	BzrBranchCmd.Name: StashBzrChanges,
+}
+
+// CleanGitCopy, CleanSvnCopy, CleanHgCopy and CleanBzrCopy discard
+// the uncommitted changes and the untracked and ignored files in a
+// working tree.
+func CleanGitCopy(path string) error {
+	if _, err := outputLines(path, "git", "reset", "-q", "--hard"); err != nil {
+		return err
+	}
+	_, err := outputLines(path, "git", "clean", "-q", "-f", "-d", "-x")
+	return err
+}
+
+func CleanSvnCopy(path string) error {
+	if _, err := outputLines(path, "svn", "revert", "-R", "."); err != nil {
+		return err
+	}
+	_, err := outputLines(path, "svn", "cleanup", "--remove-unversioned", "--remove-ignored")
+	return err
+}
+
+func CleanHgCopy(path string) error {
+	if _, err := outputLines(path, "hg", "update", "-q", "-C", "."); err != nil {
+		return err
+	}
+	_, err := outputLines(path, "hg", "--config", "extensions.purge=", "purge", "--all")
+	return err
+}
+
+func CleanBzrCopy(path string) error {
+	if _, err := outputLines(path, "bzr", "revert", "--no-backup"); err != nil {
+		return err
+	}
+	_, err := outputLines(path, "bzr", "clean-tree", "--unknown", "--ignored", "--force")
+	return err
+}
+
+// CleanFuncs reset a copy of a repo to its committed state, they
+// are only run on copies Create makes.
+var CleanFuncs = map[string]func(path string) error{
+	GitBranchCmd.Name: CleanGitCopy,
+	SvnBranchCmd.Name: CleanSvnCopy,
+	HgBranchCmd.Name:  CleanHgCopy,
+	BzrBranchCmd.Name: CleanBzrCopy,
+}
+
+// GetGitUnpushed lists the commits on HEAD, a local branch or a tag
+// which are on no remote branch.
+func GetGitUnpushed(path string) ([]string, error) {
+	return outputLines(path, "git", "log", "--oneline", "HEAD", "--branches", "--tags", "--not", "--remotes")
+}
+
+// GetSvnUnpushed returns nothing, svn commits are made on the server.
+func GetSvnUnpushed(path string) ([]string, error) {
+	return nil, nil
+}
+
+// GetHgUnpushed lists the draft and secret commits, those which have
+// not been pushed.
+func GetHgUnpushed(path string) ([]string, error) {
+	return outputLines(path, "hg", "log", "-r", "not public()", "--template", "{node|short} {desc|firstline}\n")
+}
+
+func GetBzrUnpushed(path string) ([]string, error) {
+	return nil, errors.New("Not implemented")
+}
+
+// GetGitShelved, GetHgShelved and GetBzrShelved list the changes
+// stashed or shelved in a repo, svn has no stash.
+func GetGitShelved(path string) ([]string, error) {
+	return outputLines(path, "git", "stash", "list")
+}
+
+func GetHgShelved(path string) ([]string, error) {
+	return outputLines(path, "hg", "--config", "extensions.shelve=", "shelve", "--list")
+}
+
+func GetBzrShelved(path string) ([]string, error) {
+	cmd := exec.Command("bzr", "shelve", "--list")
+	cmd.Dir = path
+	result, err := cmd.Output()
+	// bzr exits 1 when there are shelved changes
+	if exit, ok := err.(*exec.ExitError); err != nil && !(ok && exit.ExitCode() == 1) {
+		return nil, fmt.Errorf("bzr shelve --list failed %s", err.Error())
+	}
+	var lines []string
+	for _, line := range strings.Split(string(result), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func GetSvnShelved(path string) ([]string, error) {
+	return nil, nil
+}
+
+// ShelvedFuncs list the stashed or shelved changes of a repo, which
+// are only local.
+var ShelvedFuncs = map[string]func(string) ([]string, error){
+	GitBranchCmd.Name: GetGitShelved,
+	SvnBranchCmd.Name: GetSvnShelved,
+	HgBranchCmd.Name:  GetHgShelved,
+	BzrBranchCmd.Name: GetBzrShelved,
+}
+
+// UnpushedFuncs list the commits of a repo which are only local.
+var UnpushedFuncs = map[string]func(string) ([]string, error){
+	GitBranchCmd.Name: GetGitUnpushed,
+	SvnBranchCmd.Name: GetSvnUnpushed,
+	HgBranchCmd.Name:  GetHgUnpushed,
+	BzrBranchCmd.Name: GetBzrUnpushed,
+}
+
+// GitRevPushed returns true if rev is on a remote tracking branch,
+// only refs already fetched are checked.
+func GitRevPushed(path, rev string) (bool, error) {
+	refs, err := outputLines(path, "git", "for-each-ref", "--contains", rev, "--format=%(refname)", "refs/remotes")
+	return len(refs) > 0, err
+}
+
+// SvnRevPushed returns true, svn commits are made on the server.
+func SvnRevPushed(path, rev string) (bool, error) {
+	return true, nil
+}
+
+// HgRevPushed returns true if rev is public, that is it has been
+// pushed or pulled.
+func HgRevPushed(path, rev string) (bool, error) {
+	revs, err := outputLines(path, "hg", "log", "-r", rev+" and public()", "--template", "{node}\n")
+	return len(revs) > 0, err
+}
+
+func BzrRevPushed(path, rev string) (bool, error) {
+	return false, errors.New("Not implemented")
+}
+
+// PushedFuncs check whether a revision of a repo is on a remote
+// without accessing the network.
+var PushedFuncs = map[string]func(path, rev string) (bool, error){
+	GitBranchCmd.Name: GitRevPushed,
+	SvnBranchCmd.Name: SvnRevPushed,
+	HgBranchCmd.Name:  HgRevPushed,
+	BzrBranchCmd.Name: BzrRevPushed,
 }
 
 // A LocalVCS uses packages and version control systems available at a
 // local srcpath to control a local destpath (it copies the files over).
+// If DestPath is empty the repo in SrcPath is controlled directly.
 type LocalVCS struct {
 	Package            string
 	Root               string
 	SrcPath            string
+	DestPath           string // DestPath is the GOPATH Create copies the repo into
+	CopyDot            bool   // CopyDot copies VCS metadata and other dot files to DestPath
 	Cmd                *vcs.Cmd
 	CurrentRevCmd      *VCSCmd        // CurrentRevCommand to check the current revision for sourcepath.
+	CommitCmd          *VCSCmd        // CommitCmd resolves a {rev} to an exact revision
 	RemoteCmd          *VCSCmd        // RemoteCmd to obtain the upstream (remote) for a repo
 	BranchCmd          *VCSCmd        // BranchCmd to obtains the current branch if on one
 	UpdateCmd          *VCSCmd        // UpdateCMD is used to pull remote updates but NOT update the local
@@ -348,6 +765,25 @@ type LocalVCS struct {
 	BranchUpdatedRegex *regexp.Regexp // The regex to examine if an update occured from a branch update cmd
 	SyncCmd            *VCSCmd
 	Branches           func(path string) ([]string, error)
+	Tags               func(path string) ([]string, error)
+	RevDateCmd         *VCSCmd // RevDateCmd returns the commit time of a revision
+	AheadCmd           *VCSCmd // AheadCmd counts the commits in one revision not in another
+	// Changes, Unpushed and Shelved list uncommitted changes,
+	// commits on no remote and stashed or shelved changes.
+	Changes  func(path string) ([]string, error)
+	Unpushed func(path string) ([]string, error)
+	Shelved  func(path string) ([]string, error)
+	// Pushed checks whether a revision is on a remote.
+	Pushed func(path, rev string) (bool, error)
+	// Stash sets aside uncommitted changes when Dirty is DirtyStash.
+	Stash func(path, message string) error
+	// Clean discards the changes and untracked files copied by
+	// Create.
+	Clean func(path string) error
+	// Dirty overrides the package Dirty policy if set.
+	Dirty DirtyPolicy
+	// Signature, if set, is verified after each TagSync.
+	Signature *SignaturePolicy
 }
 
 // NewLocalVCS returns a a LocalVCS with CurrentRevCmd initialized
@@ -359,34 +795,118 @@ func NewLocalVCS(pkg, root, srcPath string, cmd *vcs.Cmd) *LocalVCS {
 		SrcPath:            srcPath,
 		Cmd:                cmd,
 		CurrentRevCmd:      RevCmds[cmd.Name],
+		CommitCmd:          CommitCmds[cmd.Name],
 		RemoteCmd:          RemoteCmds[cmd.Name],
 		BranchCmd:          BranchCmds[cmd.Name],
 		UpdateCmd:          UpdateCmds[cmd.Name],
-		Branches:           BranchFuncs[cmd.Name],
+		Branches:           BranchFuncs[cmd.Name].Branches,
+		Tags:               BranchFuncs[cmd.Name].Tags,
+		Changes:            ChangeFuncs[cmd.Name],
+		Unpushed:           UnpushedFuncs[cmd.Name],
+		Shelved:            ShelvedFuncs[cmd.Name],
+		Pushed:             PushedFuncs[cmd.Name],
+		Stash:              StashFuncs[cmd.Name],
+		Clean:              CleanFuncs[cmd.Name],
+		RevDateCmd:         RevDateCmds[cmd.Name],
+		AheadCmd:           AheadCmds[cmd.Name],
 		BranchUpdateCmd:    BranchUpdateCmds[cmd.Name],
 		BranchUpdatedRegex: BranchUpdatedRegexs[cmd.Name],
 		SyncCmd:            TagSyncCmds[cmd.Name],
 	}
 }
 
+// Dir returns the directory of the repo controlled, in DestPath if
+// set.
+func (lv *LocalVCS) Dir() string {
+	if lv.DestPath != "" {
+		return PackageSource(lv.DestPath, lv.Root)
+	}
+	return PackageSource(lv.SrcPath, lv.Root)
+}
+
 // Create will copy (using a dir copier) the package from srcpath to
-// destpath and then call set.
+// destpath, discard the uncommitted changes and untracked and ignored
+// files copied with it, and then call set on the copy, the repo in
+// srcpath is never changed. A rev already in the repo is checked out
+// without updating from remotes, so branches are at their tip in
+// srcpath.
+// Without CopyDot the copy is made and set in a temporary directory
+// and then copied without dot files, so it may not be set again. If
+// there is no destpath Create sets rev in srcpath.
 func (lv *LocalVCS) Create(rev string) error {
-	return lv.SetRev(rev)
+	if lv.DestPath == "" {
+		return lv.SetRev(rev)
+	}
+	dest := lv.Dir()
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("cant copy %s to %s, it already exists", lv.Root, dest)
+	}
+	if !lv.CopyDot {
+		tmp, err := ioutil.TempDir("", "cant-copy")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		staged := *lv
+		staged.DestPath = tmp
+		staged.CopyDot = true
+		if err := staged.Create(rev); err != nil {
+			return err
+		}
+		return copyDir(staged.Dir(), dest, false)
+	}
+	LogVerbose("Copying %s from %s to %s", lv.Root, lv.SrcPath, lv.DestPath)
+	if err := copyDir(PackageSource(lv.SrcPath, lv.Root), dest, true); err != nil {
+		return err
+	}
+	if lv.Clean == nil {
+		return fmt.Errorf("cant copy %s, its changes in %s can not be discarded from the copy", lv.Root, lv.SrcPath)
+	}
+	if err := lv.Clean(dest); err != nil {
+		return fmt.Errorf("cant discard changes copied to %s %s", dest, err.Error())
+	}
+	if rev == "" {
+		return lv.SetRev(rev)
+	}
+	if err := lv.TagSync(rev); err != nil {
+		LogVerbose("Revision %s not in copy of %s, updating: %s", rev, lv.Root, err.Error())
+		return lv.SetRev(rev)
+	}
+	return nil
+}
+
+// copyDir copies src to dest with a DirCopier.
+func copyDir(src, dest string, dot bool) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("cant copy %s to %s %s", src, dest, err.Error())
+	}
+	dc := NewDirCopier(src, dest)
+	dc.CopyDot = dot
+	if err := dc.Copy(); err != nil {
+		return fmt.Errorf("cant copy %s to %s %s", src, dest, err.Error())
+	}
+	return nil
 }
 
 // SetRev will use the LocalVCS's Cmd.TagSync method to change the
 // revision of a repo if rev is not the empty string and Cmd is not
-// nil.
+// nil. When Offline the remotes are not updated first, so rev must
+// already be present locally.
 func (lv *LocalVCS) SetRev(rev string) error {
+	if lv.Cmd != nil && rev == "" && lv.Signature != nil {
+		return fmt.Errorf("cant verify signature of %s, no revision is pinned", lv.Root)
+	}
 	if lv.Cmd == nil || rev == "" {
 		return nil
 	}
-	src := PackageSource(lv.SrcPath, lv.Root)
+	src := lv.Dir()
 	// Update against remotes if we need too
 	if lv.UpdateCmd != nil {
 		if _, err := lv.UpdateCmd.Exec(src); err != nil {
-			return err
+			if !IsOffline(err) {
+				return err
+			}
+			LogVerbose("Not updating %s: %s", lv.Root, err.Error())
 		}
 	}
 	// For revisions we just want to check it out
@@ -396,21 +916,204 @@ func (lv *LocalVCS) SetRev(rev string) error {
 	return nil
 }
 
+// TagSync checks out rev. If rev is a version constraint the highest
+// matching tag is checked out. If the LocalVCS has a Signature policy
+// the checked out revision is then verified. Uncommitted changes are
+// handled by the Dirty policy unless rev is already checked out.
 func (lv *LocalVCS) TagSync(rev string) error {
+	if IsConstraint(rev) {
+		tag, err := lv.ResolveConstraint(rev)
+		if err != nil {
+			return err
+		}
+		LogVerbose("Resolved %s %s to tag %s", lv.Root, rev, tag)
+		rev = tag
+	}
+	if current, err := lv.GetRev(); err != nil || current != rev {
+		if err := lv.protectChanges("checkout of " + rev); err != nil {
+			return err
+		}
+	}
+	if err := lv.tagSync(rev); err != nil {
+		return err
+	}
+	return lv.VerifySignature(rev)
+}
+
+// protectChanges applies the Dirty policy to any uncommitted changes
+// in the repo before op.
+func (lv *LocalVCS) protectChanges(op string) error {
+	policy := lv.Dirty
+	if policy == "" {
+		policy = Dirty
+	}
+	if policy == DirtyForce || lv.Cmd == nil {
+		return nil
+	}
+	changes, err := lv.LocalChanges()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if policy != DirtyStash {
+		return &DirtyError{Root: lv.Root, Dir: lv.Dir(), Changes: changes}
+	}
+	if lv.Stash == nil {
+		return fmt.Errorf("cant stash changes in %s, %s has no stash", lv.Root, lv.Cmd.Name)
+	}
+	LogVerbose("Stashing %d changes in %s before %s", len(changes), lv.Root, op)
+	if err := lv.Stash(lv.Dir(), "cant: before "+op); err != nil {
+		return fmt.Errorf("cant stash changes in %s %s", lv.Root, err.Error())
+	}
+	return nil
+}
+
+func (lv *LocalVCS) tagSync(rev string) error {
 	LogVerbose("Tag sync to: %s", rev)
 	if lv.SyncCmd == nil {
 		return nil
 	}
-	_, err := lv.SyncCmd.ExecReplace(PackageSource(lv.SrcPath, lv.Root), map[string]string{"{tag}": rev})
-	if err == nil {
-		return nil
+	_, err := lv.SyncCmd.ExecReplace(lv.Dir(), map[string]string{"{tag}": rev})
+	if err == nil || IsOffline(err) {
+		return err
 	}
 	LogVerbose("Tag sync failed with err: %s", err.Error())
-	return lv.Cmd.TagSync(PackageSource(lv.SrcPath, lv.Root), rev)
+	return lv.Cmd.TagSync(lv.Dir(), rev)
+}
+
+// VerifySignature checks the checked out revision rev satisfies the
+// LocalVCS's Signature policy, if any.
+func (lv *LocalVCS) VerifySignature(rev string) error {
+	if lv.Signature == nil || lv.Cmd == nil {
+		return nil
+	}
+	verify := SignatureFuncs[lv.Cmd.Name]
+	if verify == nil {
+		return fmt.Errorf("cant verify signature of %s, %s signatures are not supported", lv.Root, lv.Cmd.Name)
+	}
+	if err := verify(lv.Dir(), rev, lv.Signature); err != nil {
+		return fmt.Errorf("cant verify signature of %s, %s", lv.Root, err.Error())
+	}
+	return nil
+}
+
+// Newer returns whichever of revisions a and b is newer. If one is
+// an ancestor of the other the descendant is newer, otherwise the
+// one with the later commit time. Constraints are compared by the
+// tag they resolve to.
+func (lv *LocalVCS) Newer(a, b string) (string, error) {
+	ahead, behind, err := lv.Distance(a, b)
+	switch {
+	case err != nil:
+		LogVerbose("Cant compare ancestry of %s and %s in %s %s", a, b, lv.Root, err.Error())
+	case behind == 0:
+		return b, nil
+	case ahead == 0:
+		return a, nil
+	}
+	if lv.RevDateCmd == nil {
+		return "", fmt.Errorf("cant compare revisions of %s", lv.Root)
+	}
+	var dates []int64
+	for _, rev := range []string{a, b} {
+		resolved, err := lv.resolveRev(rev)
+		if err != nil {
+			return "", err
+		}
+		out, err := lv.RevDateCmd.ExecReplace(lv.Dir(), map[string]string{"{rev}": resolved})
+		if err != nil {
+			return "", fmt.Errorf("cant get date of %s %s %s", lv.Root, rev, err.Error())
+		}
+		date, err := strconv.ParseInt(out, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		dates = append(dates, date)
+	}
+	if dates[1] > dates[0] {
+		return b, nil
+	}
+	return a, nil
+}
+
+// Distance returns the number of commits in to which are not in
+// from (ahead) and in from which are not in to (behind).
+func (lv *LocalVCS) Distance(from, to string) (ahead, behind int, err error) {
+	if lv.AheadCmd == nil {
+		return 0, 0, fmt.Errorf("cant compare ancestry of %s revisions", lv.Cmd.Name)
+	}
+	if from, err = lv.resolveRev(from); err != nil {
+		return 0, 0, err
+	}
+	if to, err = lv.resolveRev(to); err != nil {
+		return 0, 0, err
+	}
+	count := func(base, rev string) (int, error) {
+		out, err := lv.AheadCmd.ExecReplace(lv.Dir(), map[string]string{"{base}": base, "{rev}": rev})
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(out)
+	}
+	if ahead, err = count(from, to); err != nil {
+		return 0, 0, err
+	}
+	if behind, err = count(to, from); err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
+}
+
+// resolveRev returns the tag rev resolves to if it is a constraint.
+func (lv *LocalVCS) resolveRev(rev string) (string, error) {
+	if IsConstraint(rev) {
+		return lv.ResolveConstraint(rev)
+	}
+	return rev, nil
+}
+
+// ResolveCommit returns the exact revision of rev, which may be a
+// branch, tag, version constraint or revision in the repo.
+func (lv *LocalVCS) ResolveCommit(rev string) (string, error) {
+	if lv.CommitCmd == nil {
+		return "", fmt.Errorf("cant resolve revisions of %s", lv.Root)
+	}
+	resolved, err := lv.resolveRev(rev)
+	if err != nil {
+		return "", err
+	}
+	commit, err := lv.CommitCmd.ExecReplace(lv.Dir(), map[string]string{"{rev}": resolved})
+	if err != nil {
+		return "", fmt.Errorf("cant resolve %s of %s %s", rev, lv.Root, err.Error())
+	}
+	return commit, nil
+}
+
+// ResolveConstraint returns the tag with the highest version matching
+// the constraint.
+func (lv *LocalVCS) ResolveConstraint(constraint string) (string, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	if lv.Tags == nil {
+		return "", fmt.Errorf("cant list tags of %s to resolve %s", lv.Root, constraint)
+	}
+	tags, err := lv.Tags(lv.Dir())
+	if err != nil {
+		return "", fmt.Errorf("cant list tags of %s %s", lv.Root, err.Error())
+	}
+	tag, ok := c.Best(tags)
+	if !ok {
+		return "", fmt.Errorf("no tag of %s matches %s", lv.Root, constraint)
+	}
+	return tag, nil
 }
 
 func (lv *LocalVCS) RevIsBranch(rev string) bool {
-	branches, err := lv.Branches(PackageSource(lv.SrcPath, lv.Root))
+	branches, err := lv.Branches(lv.Dir())
 	if err != nil {
 		LogVerbose("Error getting branches %s", err.Error())
 		return false
@@ -431,7 +1134,7 @@ func (lv *LocalVCS) GetRev() (string, error) {
 	if lv.CurrentRevCmd == nil || lv.Cmd == nil {
 		return "", nil
 	}
-	return lv.CurrentRevCmd.Exec(PackageSource(lv.SrcPath, lv.Root))
+	return lv.CurrentRevCmd.Exec(lv.Dir())
 
 }
 
@@ -441,7 +1144,42 @@ func (lv *LocalVCS) GetSource() (string, error) {
 	if lv.RemoteCmd == nil {
 		return "", nil
 	}
-	return lv.RemoteCmd.Exec(PackageSource(lv.SrcPath, lv.Root))
+	return lv.RemoteCmd.Exec(lv.Dir())
+}
+
+// LocalChanges returns the uncommitted changes in the repo, if any.
+func (lv *LocalVCS) LocalChanges() ([]string, error) {
+	if lv.Changes == nil {
+		return nil, fmt.Errorf("cant check %s for uncommitted changes", lv.Root)
+	}
+	return lv.Changes(lv.Dir())
+}
+
+// LocalCommits returns the commits in the repo which have not been
+// pushed to any remote, if any.
+func (lv *LocalVCS) LocalCommits() ([]string, error) {
+	if lv.Unpushed == nil {
+		return nil, fmt.Errorf("cant check %s for unpushed commits", lv.Root)
+	}
+	return lv.Unpushed(lv.Dir())
+}
+
+// LocalShelved returns the stashed or shelved changes in the repo, if
+// any.
+func (lv *LocalVCS) LocalShelved() ([]string, error) {
+	if lv.Shelved == nil {
+		return nil, fmt.Errorf("cant check %s for stashed changes", lv.Root)
+	}
+	return lv.Shelved(lv.Dir())
+}
+
+// RevPushed returns true if rev is on a remote tracking ref already
+// fetched into the repo.
+func (lv *LocalVCS) RevPushed(rev string) (bool, error) {
+	if lv.Pushed == nil {
+		return false, fmt.Errorf("cant check %s for unpushed revisions", lv.Root)
+	}
+	return lv.Pushed(lv.Dir(), rev)
 }
 
 // GetRoot on a LocalVCS will return PackageName for SrcPath
@@ -452,20 +1190,34 @@ func (lv *LocalVCS) GetRoot() string {
 // GetBranch on a LocalVCS will return the branch (if any) for the
 // current local repo. If none GetBranch will return an error.
 func (lv *LocalVCS) GetBranch() (string, error) {
-	return lv.BranchCmd.Exec(PackageSource(lv.SrcPath, lv.Root))
+	return lv.BranchCmd.Exec(lv.Dir())
 }
 
 // UpdateBranch will return true if the local branch was updated,
 // false if not. Error will be non nil if an error occured during the
-// udpate.
+// udpate. Uncommitted changes are handled by the Dirty policy first.
+// If the LocalVCS has a Signature policy the updated revision is
+// verified, and the branch is not reported as updated if it fails.
 func (lv *LocalVCS) UpdateBranch(branch string) (updated bool, update string, err error) {
 	if !lv.RevIsBranch(branch) {
 		return false, fmt.Sprintf("rev %s is not a branch", branch), nil
 	}
+	if err := lv.protectChanges("update of " + branch); err != nil {
+		return false, "", err
+	}
 	res, err := lv.BranchUpdateCmd.ExecReplace(
-		PackageSource(lv.SrcPath, lv.Root),
+		lv.Dir(),
 		map[string]string{"{branch}": branch},
 	)
+	if err == nil && lv.Signature != nil {
+		rev, err := lv.GetRev()
+		if err != nil {
+			return false, res, fmt.Errorf("cant get revision of %s %s", lv.Root, err.Error())
+		}
+		if err := lv.VerifySignature(rev); err != nil {
+			return false, res, err
+		}
+	}
 	if lv.BranchUpdatedRegex.Match([]byte(res)) {
 		return true, res, err
 	}
@@ -495,6 +1247,17 @@ var VCSTypes = []VCSType{
 // VCSTypes array, checking for prefixes that match and attempting to
 // ping the VCS with the given scheme
 func GuessVCS(url string) *vcs.Cmd {
+	v, _ := PingVCS(url)
+	return v
+}
+
+// PingVCS works like GuessVCS but also returns a ResolutionAttempt
+// for each VCS pinged while guessing.
+func PingVCS(url string) (*vcs.Cmd, []*ResolutionAttempt) {
+	if Offline {
+		return nil, []*ResolutionAttempt{{URL: url, Err: &OfflineError{"ping " + url}}}
+	}
+	var attempts []*ResolutionAttempt
 	for _, vt := range VCSTypes {
 		if !strings.HasPrefix(url, vt.Prefix) {
 			continue
@@ -505,11 +1268,22 @@ func GuessVCS(url string) *vcs.Cmd {
 		LogVerbose("Pinging path %s with scheme %s for vcs %s", path, vt.Scheme, vt.VCS.Name)
 		if err := vt.VCS.Ping(vt.Scheme, path); err != nil {
 			LogVerbose("Error pinging path %s with scheme %s", path, vt.Scheme)
+			attempts = append(attempts, &ResolutionAttempt{
+				URL: url,
+				VCS: vt.VCS.Name,
+				Err: fmt.Errorf("ping with scheme %s failed %s", vt.Scheme, err.Error()),
+			})
 			continue
 		}
-		return vt.VCS
+		return vt.VCS, attempts
 	}
-	return nil
+	if len(attempts) == 0 {
+		attempts = append(attempts, &ResolutionAttempt{
+			URL: url,
+			Err: errors.New("url has no known vcs prefix"),
+		})
+	}
+	return nil, attempts
 }
 
 // PackageVCS wraps the underlying golang.org/x/tools/go/vcs to
@@ -518,21 +1292,35 @@ func GuessVCS(url string) *vcs.Cmd {
 type PackageVCS struct {
 	Repo   *vcs.RepoRoot
 	Gopath string
+	// Signature, if set, is verified after SetRev.
+	Signature *SignaturePolicy
+}
+
+// localVCS returns a LocalVCS for the repo once created.
+func (pv *PackageVCS) localVCS() *LocalVCS {
+	lv := NewLocalVCS(pv.Repo.Root, pv.Repo.Root, pv.Gopath, pv.Repo.VCS)
+	lv.Signature = pv.Signature
+	return lv
 }
 
 // UpdateBranch will attempt to construct a local vcs and update that.
 func (pv *PackageVCS) UpdateBranch(branch string) (updated bool, update string, err error) {
-	lv := NewLocalVCS(pv.Repo.Root, pv.Repo.Root, pv.Gopath, pv.Repo.VCS)
-	return lv.UpdateBranch(branch)
+	return pv.localVCS().UpdateBranch(branch)
 }
 
 // Create clones the VCS into the location provided by Repo.Root
 func (pv *PackageVCS) Create(rev string) error {
+	if Offline {
+		return &OfflineError{"clone " + pv.Repo.Repo}
+	}
 	v := pv.Repo.VCS
 	dir := PackageSource(pv.Gopath, pv.Repo.Root)
 	if err := v.Create(dir, pv.Repo.Repo); err != nil {
 		return err
 	}
+	if rev == "" && pv.Signature != nil {
+		return fmt.Errorf("cant verify signature of %s, no revision is pinned", pv.Repo.Root)
+	}
 	if rev == "" {
 		return nil
 	}
@@ -543,8 +1331,7 @@ func (pv *PackageVCS) Create(rev string) error {
 // provided. This also modifies the git based vcs to be able to deal
 // with non named revisions (sigh).
 func (pv *PackageVCS) SetRev(rev string) error {
-	lv := NewLocalVCS(pv.Repo.Root, pv.Repo.Root, pv.Gopath, pv.Repo.VCS)
-	return lv.TagSync(rev)
+	return pv.localVCS().TagSync(rev)
 }
 
 // GetRev does not work on remote VCS's and will always return a not
@@ -569,12 +1356,40 @@ func (pv *PackageVCS) GetBranch() (string, error) {
 	return "", errors.New("package VCS currently does not support GetBranch")
 }
 
+// A ResolutionAttempt records a single RepoResolver's attempt to
+// resolve an import path: the url tried, the vcs pinged (if any) and
+// the resulting error.
+type ResolutionAttempt struct {
+	Resolver   string
+	ImportPath string
+	URL        string
+	VCS        string
+	Err        error
+}
+
+// String prints the attempt on a single line.
+func (ra *ResolutionAttempt) String() string {
+	str := fmt.Sprintf("%s: %s", ra.Resolver, ra.ImportPath)
+	if ra.URL != "" {
+		str += fmt.Sprintf(" url %s", ra.URL)
+	}
+	if ra.VCS != "" {
+		str += fmt.Sprintf(" vcs %s", ra.VCS)
+	}
+	if ra.Err != nil {
+		str += fmt.Sprintf(" failed: %s", ra.Err.Error())
+	}
+	return str
+}
+
 // A ResolutionFailureError contains status as to whether this is a resolution failure
-// or of some other type
+// or of some other type. Attempts holds the trace of each resolver
+// tried, if known.
 type ResolutionFailureError struct {
-	Err error
-	Pkg string
-	VCS string
+	Err      error
+	Pkg      string
+	VCS      string
+	Attempts []*ResolutionAttempt
 }
 
 // A NewResolutionFailureError with the pkg and vcs passed in
@@ -586,9 +1401,34 @@ func NewResolutionFailureError(pkg, vcs string) *ResolutionFailureError {
 	}
 }
 
-// Error message attached to this vcs error
+// NewResolutionAttemptError returns a ResolutionFailureError for a
+// single failed attempt by resolver.
+func NewResolutionAttemptError(resolver, pkg, url, vcs string, err error) *ResolutionFailureError {
+	re := NewResolutionFailureError(pkg, resolver)
+	re.Attempts = []*ResolutionAttempt{{
+		Resolver:   resolver,
+		ImportPath: pkg,
+		URL:        url,
+		VCS:        vcs,
+		Err:        err,
+	}}
+	return re
+}
+
+// Error message attached to this vcs error, including each
+// attempt if there was more than one.
 func (re ResolutionFailureError) Error() string {
-	return re.Err.Error()
+	if len(re.Attempts) < 2 {
+		if len(re.Attempts) == 1 && re.Attempts[0].Err != nil {
+			return fmt.Sprintf("%s: %s", re.Err.Error(), re.Attempts[0].Err.Error())
+		}
+		return re.Err.Error()
+	}
+	str := re.Err.Error()
+	for _, attempt := range re.Attempts {
+		str += "\n\t" + attempt.String()
+	}
+	return str
 }
 
 // ResolutionFailureErr will return non nil if a RepoResolver could not
@@ -632,20 +1472,23 @@ func TrimPathToRoot(importPath, root string) (string, error) {
 func (dr *DefaultRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
 	// We guess our vcs based off our url path if present
 	resolvePath := getResolvePath(importPath)
+	if Offline {
+		return nil, NewResolutionAttemptError("default", importPath, resolvePath, "", &OfflineError{"discover repo for " + resolvePath})
+	}
 
 	LogVerbose("Attempting to use go get vcs for url: %s", resolvePath)
 	vcs.Verbose = Verbose
 	repo, err := vcs.RepoRootForImportPath(resolvePath, true)
 	if err != nil {
 		LogVerbose("Failed creating VCS for url: %s, err: %s", resolvePath, err.Error())
-		return nil, err
+		return nil, NewResolutionAttemptError("default", importPath, resolvePath, "", err)
 	}
 
 	// If we found something return non nil
 	repo.Root, err = TrimPathToRoot(importPath, repo.Root)
 	if err != nil {
 		LogVerbose("Failed creating VCS for url: %s, err: %s", resolvePath, err.Error())
-		return nil, err
+		return nil, NewResolutionAttemptError("default", importPath, repo.Repo, repo.VCS.Name, err)
 	}
 	v := &PackageVCS{Repo: repo, Gopath: dr.Gopath}
 	LogVerbose("Created VCS for url: %s", resolvePath)
@@ -667,14 +1510,20 @@ func (rr *RemoteRepoResolver) ResolveRepo(importPath string, dep *CanticleDepend
 	}
 	// Attempt our internal guessing logic first
 	LogVerbose("Attempting to use default resolver for url: %s", resolvePath)
-	v := GuessVCS(resolvePath)
+	v, attempts := PingVCS(resolvePath)
 	if v == nil {
-		return nil, NewResolutionFailureError(importPath, "remote")
+		re := NewResolutionFailureError(importPath, "remote")
+		for _, attempt := range attempts {
+			attempt.Resolver = "remote"
+			attempt.ImportPath = importPath
+		}
+		re.Attempts = attempts
+		return nil, re
 	}
 
-	root := dep.Root
-	if root == "" {
-		root = importPath
+	root := importPath
+	if dep != nil && dep.Root != "" {
+		root = dep.Root
 	}
 	pv := &PackageVCS{
 		Repo: &vcs.RepoRoot{
@@ -713,40 +1562,61 @@ func (lr *LocalRepoResolver) ResolveRepo(pkg string, dep *CanticleDependency) (V
 	switch {
 	case err != nil:
 		LogVerbose("Error stating local copy of package: %s %s\n", fullPath, err.Error())
-		return nil, err
+		return nil, NewResolutionAttemptError("local", pkg, fullPath, "", err)
 	case s != nil && s.IsDir():
-		cmd, root, err := vcs.FromDir(fullPath, lr.LocalPath)
+		entry := GoPathEntry(lr.LocalPath, fullPath)
+		cmd, root, err := vcs.FromDir(fullPath, entry)
 		if err != nil {
 			LogVerbose("Error with local vcs: %s", err.Error())
-			return nil, err
+			return nil, NewResolutionAttemptError("local", pkg, fullPath, "", err)
 		}
-		root, _ = PackageName(lr.LocalPath, path.Join(lr.LocalPath, root))
+		root, _ = PackageName(entry, path.Join(entry, root))
 		v := NewLocalVCS(root, root, lr.LocalPath, cmd)
 		LogVerbose("Created vcs for local pkg: %+v", v)
 		return v, nil
 	default:
 		LogVerbose("Could not resolve local vcs for package: %s", fullPath)
-		return nil, NewResolutionFailureError(pkg, "local")
+		return nil, NewResolutionAttemptError("local", pkg, fullPath, "", errors.New("not a directory"))
 	}
 }
 
 // CompositeRepoResolver calls the repos in resolvers in order,
-// discarding errors and returning the first VCS found.
+// returning the first VCS found.
 type CompositeRepoResolver struct {
 	Resolvers []RepoResolver
 }
 
-// ResolveRepo for the composite attempts its sub Resolvers in order
-// ignoring any errors. If all resolvers fail a ResolutionFailureError
-// will be returned.
+// ResolveRepo for the composite attempts its sub Resolvers in order.
+// If all resolvers fail a ResolutionFailureError will be returned
+// with the Attempts of each sub resolver.
 func (cr *CompositeRepoResolver) ResolveRepo(importPath string, dep *CanticleDependency) (VCS, error) {
+	var attempts []*ResolutionAttempt
 	for _, r := range cr.Resolvers {
 		vcs, err := r.ResolveRepo(importPath, dep)
 		if vcs != nil && err == nil {
 			return vcs, nil
 		}
+		attempts = append(attempts, resolutionAttempts(r, importPath, err)...)
+	}
+	re := NewResolutionFailureError(importPath, "composite")
+	re.Attempts = attempts
+	return nil, re
+}
+
+// resolutionAttempts returns the attempts recorded in err, or a
+// single attempt naming r if err does not record any.
+func resolutionAttempts(r RepoResolver, importPath string, err error) []*ResolutionAttempt {
+	if re := ResolutionFailureErr(err); re != nil && len(re.Attempts) > 0 {
+		return re.Attempts
+	}
+	if err == nil {
+		err = errors.New("no vcs returned")
 	}
-	return nil, NewResolutionFailureError(importPath, "composite")
+	return []*ResolutionAttempt{{
+		Resolver:   fmt.Sprintf("%T", r),
+		ImportPath: importPath,
+		Err:        err,
+	}}
 }
 
 type resolve struct {
@@ -2,10 +2,13 @@ package canticles
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"regexp"
+	"strings"
 	"testing"
 
 	"golang.org/x/tools/go/vcs"
@@ -153,6 +156,64 @@ func TestResolveRootWithNoSlash(t *testing.T) {
 
 }
 
+// testGitRepo is a git repo for root in a test GOPATH. Commands run
+// with HOME set to the GOPATH so no user configuration is read.
+type testGitRepo struct {
+	t      *testing.T
+	gopath string
+	root   string
+	dir    string
+	env    []string
+}
+
+// newTestGitRepo inits a git repo for root in gopath, skipping the
+// test if git is not installed.
+func newTestGitRepo(t *testing.T, gopath, root string) *testGitRepo {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Can not test repos without git")
+	}
+	tr := &testGitRepo{t: t, gopath: gopath, root: root, dir: PackageSource(gopath, root)}
+	if err := os.MkdirAll(tr.dir, 0755); err != nil {
+		t.Fatalf("Error creating repo dir: %s", err.Error())
+	}
+	tr.git("init", "-q")
+	return tr
+}
+
+func (tr *testGitRepo) run(dir, name string, args ...string) string {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(PatchEnviroment(os.Environ(), "HOME", tr.gopath), tr.env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		tr.t.Fatalf("Error running %s %v: %s %s", name, args, err.Error(), string(out))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (tr *testGitRepo) git(args ...string) string {
+	return tr.run(tr.dir, "git", append([]string{"-c", "user.name=test", "-c", "user.email=test@test.com"}, args...)...)
+}
+
+func (tr *testGitRepo) write(file, content string) {
+	file = path.Join(tr.dir, file)
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		tr.t.Fatalf("Error creating dir %s", err.Error())
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		tr.t.Fatalf("Error writing file %s", err.Error())
+	}
+}
+
+// commit writes content to file and commits it, returning the new
+// revision.
+func (tr *testGitRepo) commit(file, content string) string {
+	tr.write(file, content)
+	tr.git("add", file)
+	tr.git("commit", "-q", "-m", file)
+	return tr.git("rev-parse", "HEAD")
+}
+
 type TestVCS struct {
 	Updated int
 	Created int
@@ -245,6 +306,26 @@ func TestCompositeRepoResolver(t *testing.T) {
 	if re := ResolutionFailureErr(err); re == nil {
 		t.Errorf("CompositeRepoResolver did not return resolution failure")
 	}
+
+	// Attempts from each child should be recorded in order
+	attemptErr := NewResolutionAttemptError("remote", dep.Root, "git@test.com:testi", "Git", errTest)
+	tr1 = &testResolver{response: []resolve{{nil, errTest}}}
+	tr2 = &testResolver{response: []resolve{{nil, attemptErr}}}
+	cr = &CompositeRepoResolver{[]RepoResolver{tr1, tr2}}
+	v, err = cr.ResolveRepo(dep.Root, dep)
+	re := ResolutionFailureErr(err)
+	if re == nil {
+		t.Fatalf("CompositeRepoResolver did not return resolution failure")
+	}
+	if len(re.Attempts) != 2 {
+		t.Fatalf("CompositeRepoResolver expected 2 attempts got %d", len(re.Attempts))
+	}
+	if re.Attempts[0].Err != errTest || re.Attempts[0].ImportPath != dep.Root {
+		t.Errorf("CompositeRepoResolver bad attempt for error without trace %+v", re.Attempts[0])
+	}
+	if re.Attempts[1] != attemptErr.Attempts[0] {
+		t.Errorf("CompositeRepoResolver did not keep child attempt %+v", re.Attempts[1])
+	}
 }
 
 func TestMemoizedRepoResolver(t *testing.T) {
@@ -386,3 +467,174 @@ func TestLocalVCS(t *testing.T) {
 		t.Errorf("Error setting rev to testrev: %s", err.Error())
 	}
 }
+
+func TestOffline(t *testing.T) {
+	Offline = true
+	defer func() { Offline = false }()
+
+	remoteCmd := &VCSCmd{
+		Name:       "Test",
+		Cmd:        "echo",
+		Args:       []string{expectedRev},
+		ParseRegex: regexp.MustCompile(`^(\S+)$`),
+		Remote:     true,
+	}
+	if _, err := remoteCmd.Exec(os.TempDir()); !IsOffline(err) {
+		t.Errorf("Remote VCSCmd did not return offline error: %v", err)
+	}
+	if _, err := TestRevCmd.Exec(os.TempDir()); err != nil {
+		t.Errorf("Local VCSCmd returned error when offline: %s", err.Error())
+	}
+
+	v, attempts := PingVCS("git@test.com:test/test.git")
+	if v != nil {
+		t.Errorf("PingVCS returned vcs when offline")
+	}
+	if len(attempts) != 1 || !IsOffline(attempts[0].Err) {
+		t.Errorf("PingVCS did not record offline attempt %+v", attempts)
+	}
+
+	dr := &DefaultRepoResolver{os.TempDir()}
+	_, err := dr.ResolveRepo("golang.org/x/tools/go/vcs", nil)
+	re := ResolutionFailureErr(err)
+	if re == nil || len(re.Attempts) != 1 || !IsOffline(re.Attempts[0].Err) {
+		t.Errorf("DefaultRepoResolver did not fail with offline error: %v", err)
+	}
+
+	pv := &PackageVCS{Repo: &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: "https://test.com/test", Root: "test.com/test"}, Gopath: os.TempDir()}
+	if err := pv.Create(""); !IsOffline(err) {
+		t.Errorf("PackageVCS Create did not return offline error: %v", err)
+	}
+}
+
+func TestLocalVCSCopy(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-copy")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	src, dest, export := path.Join(testHome, "src"), path.Join(testHome, "dest"), path.Join(testHome, "export")
+	tr := newTestGitRepo(t, src, "test.com/a")
+	first := tr.commit("a", "one")
+	head := tr.commit("a", "two")
+
+	lv := NewLocalVCS("test.com/a", "test.com/a", src, vcs.ByCmd("git"))
+	lv.DestPath = dest
+	lv.CopyDot = true
+	if err := lv.Create(first); err != nil {
+		t.Fatalf("Error creating copy: %s", err.Error())
+	}
+	if rev, err := lv.GetRev(); err != nil || rev != first {
+		t.Errorf("Expected copy at %s got %s %v", first, rev, err)
+	}
+	if rev := tr.git("rev-parse", "HEAD"); rev != head {
+		t.Errorf("Create changed the source repo to %s", rev)
+	}
+	if err := lv.Create(first); err == nil {
+		t.Errorf("Create returned no error copying over an existing repo")
+	}
+
+	lv.DestPath = export
+	lv.CopyDot = false
+	if err := lv.Create(first); err != nil {
+		t.Fatalf("Error exporting copy: %s", err.Error())
+	}
+	if b, err := ioutil.ReadFile(PackageSource(export, "test.com/a/a")); err != nil || string(b) != "one" {
+		t.Errorf("Expected export at first revision got %s %v", string(b), err)
+	}
+	if _, err := os.Stat(PackageSource(export, "test.com/a/.git")); !os.IsNotExist(err) {
+		t.Errorf("Expected export without VCS metadata %v", err)
+	}
+
+	// Changes in the source are not copied
+	tr.write("a", "edited")
+	tr.write("b", "untracked")
+	for i, rev := range []string{"", first} {
+		lv.DestPath = path.Join(testHome, fmt.Sprintf("dirty%d", i))
+		lv.CopyDot = true
+		if err := lv.Create(rev); err != nil {
+			t.Errorf("Error copying a dirty repo at %q: %s", rev, err.Error())
+			continue
+		}
+		expected := map[string]string{"": "two", first: "one"}[rev]
+		if b, err := ioutil.ReadFile(path.Join(lv.Dir(), "a")); err != nil || string(b) != expected {
+			t.Errorf("Expected copy at %q to have committed %s got %s %v", rev, expected, string(b), err)
+		}
+		if _, err := os.Stat(path.Join(lv.Dir(), "b")); !os.IsNotExist(err) {
+			t.Errorf("Expected copy at %q without untracked files %v", rev, err)
+		}
+	}
+	if b, err := ioutil.ReadFile(path.Join(tr.dir, "a")); err != nil || string(b) != "edited" {
+		t.Errorf("Create discarded the changes in the source repo %s %v", string(b), err)
+	}
+}
+
+func TestLocalVCSDirty(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-dirty")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	tr := newTestGitRepo(t, testHome, "test.com/a")
+	first := tr.commit("a", "one")
+	head := tr.commit("a", "two")
+
+	lv := NewLocalVCS("test.com/a", "test.com/a", testHome, vcs.ByCmd("git"))
+	tr.write("a", "edited")
+	tr.write("b", "untracked")
+	if err := lv.TagSync(first); !IsDirty(err) {
+		t.Fatalf("Expected a DirtyError checking out over changes got %v", err)
+	}
+	if rev := tr.git("rev-parse", "HEAD"); rev != head {
+		t.Errorf("Refused checkout changed the repo to %s", rev)
+	}
+	if err := lv.TagSync(head); err != nil {
+		t.Errorf("Error syncing a dirty repo to its current revision: %s", err.Error())
+	}
+
+	lv.Dirty = DirtyStash
+	if err := lv.TagSync(first); err != nil {
+		t.Fatalf("Error stashing and checking out: %s", err.Error())
+	}
+	if rev := tr.git("rev-parse", "HEAD"); rev != first {
+		t.Errorf("Expected repo at %s got %s", first, rev)
+	}
+	if stashes := tr.git("stash", "list"); !strings.Contains(stashes, "cant: before checkout of "+first) {
+		t.Errorf("Expected the changes stashed got %q", stashes)
+	}
+	if _, err := os.Stat(path.Join(tr.dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("Expected the untracked file stashed %v", err)
+	}
+
+	tr.write("b", "untracked")
+	lv.Dirty = DirtyForce
+	if err := lv.TagSync(head); err != nil {
+		t.Errorf("Error forcing a checkout: %s", err.Error())
+	}
+	if b, err := ioutil.ReadFile(path.Join(tr.dir, "b")); err != nil || string(b) != "untracked" {
+		t.Errorf("Expected forced checkout to keep the untracked file got %s %v", string(b), err)
+	}
+}
+
+func TestLocalVCSRevPushed(t *testing.T) {
+	testHome, err := ioutil.TempDir("", "cant-test-pushed")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(testHome)
+	tr := newTestGitRepo(t, testHome, "test.com/a")
+	remote := path.Join(testHome, "remote.git")
+	tr.git("init", "-q", "--bare", remote)
+	tr.git("remote", "add", "origin", remote)
+	pushed := tr.commit("a", "one")
+	tr.git("push", "-q", "origin", "HEAD")
+	local := tr.commit("a", "two")
+
+	lv := NewLocalVCS("test.com/a", "test.com/a", testHome, vcs.ByCmd("git"))
+	if ok, err := lv.RevPushed(pushed); err != nil || !ok {
+		t.Errorf("Expected %s pushed got %v %v", pushed, ok, err)
+	}
+	if ok, err := lv.RevPushed(local); err != nil || ok {
+		t.Errorf("Expected %s not pushed got %v %v", local, ok, err)
+	}
+}
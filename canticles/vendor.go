@@ -1,28 +1,39 @@
 package canticles
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 type Vendor struct {
-	flags    *flag.FlagSet
-	Verbose  bool
-	Sources  string
-	Resolver ConflictResolver
+	flags     *flag.FlagSet
+	Verbose   bool
+	Sources   string
+	Emit      string
+	Dest      string
+	Platforms BuildContexts
+	Scopes    ScopeFlags
+	Resolver  ConflictResolver
+	Resolvers ResolverFlags
 }
 
 func NewVendor() *Vendor {
-	f := flag.NewFlagSet("save", flag.ExitOnError)
+	f := flag.NewFlagSet("vendor", flag.ExitOnError)
 	s := &Vendor{
 		flags:    f,
 		Resolver: &PromptResolution{},
+		Scopes:   ScopeFlags(NewStringSet()),
 	}
 	f.BoolVar(&s.Verbose, "v", false, "Be verbose when getting stuff")
 	f.StringVar(&s.Sources, "s", "", "Use this canticle file to source repos.")
+	f.StringVar(&s.Dest, "o", "", "Vendor into this GOPATH, using the current GOPATH as a cache.")
+	f.StringVar(&s.Emit, "emit", "", "Write a Canticle file of the revisions vendored to this file.")
+	f.Var(&s.Platforms, "platform", "Read imports under this goos/goarch[:tags], may be repeated.")
+	f.Var(s.Scopes, "scope", "Only vendor dependencies in these comma seperated scopes (runtime, test, tool)")
+	s.Resolvers.Register(f, "local,remote,default")
 	return s
 }
 
@@ -30,13 +41,32 @@ var vendor = NewVendor()
 
 var VendorCommand = &Command{
 	Name:             "vendor",
-	UsageLine:        "vendor [-v] [-s sourcefile]",
+	UsageLine:        "vendor [-v] [-s sourcefile] [-o <dir>] [-emit <file>] [-platform <goos/goarch[:tags]>] [-scope <scopes>] [-resolvers <list>] [-no-cache] [-refresh-cache] [-cache-ttl <duration>]",
 	ShortDescription: "Download the all dependencies of a project.",
 	LongDescription: `The vendor command will download all dependencies of a package in its go and Canticle dependency graph.
 
 Specify -v to print out a verbose set of operations instead of just errors.
 
-Specify -s <filename>, where filename contains Canticle deps to specify alternative sources to fetch packages from.`,
+Specify -s <filename>, where filename contains Canticle deps to specify alternative sources to fetch packages from. Without -s the Canticle.lock, or Canticle file, of each package is used. Repos with a Revision are checked out at it, even if already on disk, and those with a Hash verified against it. Repos fetched without a Revision are left at their default branch and reported.
+
+Specify -o <dir> to vendor into the GOPATH dir instead of the current GOPATH, for example to build a Docker context, the package itself is vendored too. Repos in the current GOPATH are copied from there, with their VCS metadata but without uncommitted changes or untracked files, instead of fetched from the network and revisions already in them checked out without updating, so keep them up to date. Only repos not found there are fetched with the remote resolvers.
+
+Specify -emit <filename> to write a Canticle file locking every repo vendored to the revision and source on disk, for example to pin them with -s next time.
+
+Specify -platform to follow imports under a matrix of build contexts, for example -platform linux/amd64 -platform windows/amd64:integration, so dependencies only imported on other platforms are vendored too.
+
+Specify -scope to only vendor dependencies in the comma seperated scopes given, for example -scope runtime to leave out packages only imported by tests. Scopes are runtime, test and tool, by default all are vendored.
+
+Specify -resolvers to control how repos are found, as a comma
+separated list of local, remote (guess from the source url), default
+(go get discovery), mirror=<url with {root}>,
+archive=<tar.gz url with {root} and optionally {rev}> and
+cache=<GOPATH to copy from>. The default is
+local,remote,default and may be changed with $CANTICLE_VENDOR_RESOLVERS.
+
+Specify -no-cache to not use the repo root cache, -refresh-cache to
+resolve repo roots against the network and update the cache, and
+-cache-ttl to control how long cached repo roots are trusted.`,
 	Flags: vendor.flags,
 	Cmd:   vendor,
 }
@@ -49,20 +79,17 @@ func (v *Vendor) Run(args []string) {
 
 	var deps []*CanticleDependency
 	if v.Sources != "" {
-		f, err := os.Open(v.Sources)
+		cf, err := LoadCanticleFile(v.Sources)
 		if err != nil {
-			log.Fatalf("cant open dep file %s", v.Sources)
-			return
-		}
-		LogVerbose("Reading canticle file: %s", f.Name())
-		defer f.Close()
-		d := json.NewDecoder(f)
-		if err := d.Decode(&deps); err != nil {
-			log.Fatalf("cant decode dep file %s", v.Sources)
+			log.Fatalf("cant decode dep file %s %s", v.Sources, err.Error())
 			return
 		}
+		deps = cf.Deps
 	}
 
+	if v.Emit != "" && len(v.flags.Args()) > 1 {
+		log.Fatal("cant vendor may not be run with -emit and multiple packages")
+	}
 	for _, pkg := range v.flags.Args() {
 		LogWarn("Vendoring package %s", pkg)
 		if err := v.Vendor(pkg, deps); err != nil {
@@ -77,13 +104,27 @@ func (v *Vendor) Vendor(pkg string, deps []*CanticleDependency) error {
 	if err != nil {
 		return err
 	}
-	resolvers := []RepoResolver{
-		&LocalRepoResolver{LocalPath: gopath},
-		&RemoteRepoResolver{gopath},
-		&DefaultRepoResolver{gopath},
+	if deps == nil {
+		// Read from the current GOPATH, pkg may not be in Dest yet
+		deps, err = (&DepReader{Gopath: gopath}).CanticleDependencies(pkg)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cant read Canticle file of %s %s", pkg, err.Error())
+		}
+	}
+	var resolver RepoResolver
+	if v.Dest != "" {
+		cache := gopath
+		if gopath, err = DestGoPath(cache, v.Dest); err != nil {
+			return err
+		}
+		resolver, err = v.Resolvers.CacheResolver(gopath, cache)
+	} else {
+		resolver, err = v.Resolvers.Resolver(gopath)
+	}
+	if err != nil {
+		return err
 	}
-	resolver := NewMemoizedRepoResolver(&CompositeRepoResolver{resolvers})
-	depReader := &DepReader{gopath}
+	depReader := &DepReader{Gopath: gopath, Platforms: v.Platforms, Scopes: StringSet(v.Scopes)}
 
 	// Setup our resolvers, loaders, and walkers
 	dl := NewDependencyLoader(resolver, depReader.AllDeps, deps, gopath)
@@ -93,6 +134,44 @@ func (v *Vendor) Vendor(pkg string, deps []*CanticleDependency) error {
 	if err := dw.TraverseDependencies(pkg); err != nil {
 		return fmt.Errorf("cant fetch packages %s", err.Error())
 	}
-
+	var unpinned []string
+	for _, root := range dl.Unpinned() {
+		// The package being vendored is not a dependency
+		if !PathIsChild(root, pkg) {
+			unpinned = append(unpinned, root)
+		}
+	}
+	if len(unpinned) > 0 {
+		LogWarn("Vendored %d repos with no pinned revision, at their default branch:\n\t%s", len(unpinned), strings.Join(unpinned, "\n\t"))
+	}
+	if v.Emit != "" {
+		return v.EmitDeps(gopath, pkg, dl.Dependencies())
+	}
 	return nil
 }
+
+// EmitDeps writes a Canticle file to v.Emit locking the repos of deps
+// to the revisions and sources on disk.
+func (v *Vendor) EmitDeps(gopath, pkg string, deps Dependencies) error {
+	sr := &SourcesResolver{
+		Gopath:     gopath,
+		RootPath:   PackageSource(gopath, pkg),
+		Resolver:   &LocalRepoResolver{LocalPath: gopath},
+		Sources:    true,
+		CDepReader: &DepReader{Gopath: gopath},
+	}
+	sources, err := sr.ResolveSources(deps)
+	if err != nil {
+		return fmt.Errorf("cant read vendored revisions %s", err.Error())
+	}
+	cdeps, err := (&PreferLocalResolution{}).ResolveConflicts(sources)
+	if err != nil {
+		return err
+	}
+	locked, err := LockDeps(gopath, sources, cdeps)
+	if err != nil {
+		return err
+	}
+	LogVerbose("Writing vendored deps to %s", v.Emit)
+	return WriteCanticleFile(v.Emit, NewCanticleFile(pkg, locked))
+}
@@ -0,0 +1,70 @@
+package canticles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVendorEmit(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "cant-test-vendor")
+	if err != nil {
+		t.Fatalf("Error creating tempdir: %s", err.Error())
+	}
+	defer os.RemoveAll(gopath)
+	// Resolve symlinks so EnvGoPath matches the working directory
+	if gopath, err = filepath.EvalSymlinks(gopath); err != nil {
+		t.Fatalf("Error resolving tempdir: %s", err.Error())
+	}
+	Offline = true
+	defer func() { Offline = false }()
+	a := newTestGitRepo(t, gopath, "test.com/a")
+	tagged := a.commit("a.go", "package a\n\nimport _ \"test.com/b\"\n")
+	a.git("tag", "v1.0.0")
+	a.commit("a.go", "package a\n\nimport _ \"test.com/b\"\n\nconst A = 1\n")
+	b := newTestGitRepo(t, gopath, "test.com/b")
+	b.commit("b.go", "package b\n")
+	b.git("checkout", "-q", "-b", "other")
+	other := b.commit("b.go", "package b\n\nconst B = 1\n")
+	b.git("checkout", "-q", "master")
+	app := newTestGitRepo(t, gopath, "test.com/app")
+	app.write("app.go", "package app\n\nimport _ \"test.com/a\"\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Error getting working directory: %s", err.Error())
+	}
+	defer os.Chdir(wd)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	if err := os.Chdir(app.dir); err != nil {
+		t.Fatalf("Could not chdir to app: %s", err.Error())
+	}
+	if err := os.Setenv("GOPATH", gopath); err != nil {
+		t.Fatalf("Could not set gopath: %s", err.Error())
+	}
+
+	v := NewVendor()
+	v.Resolvers.Chain, _ = ParseResolverChain("local")
+	v.Emit = filepath.Join(gopath, "Canticle.emit")
+	deps := []*CanticleDependency{
+		{Root: "test.com/a", Revision: "v1.0.0"},
+		{Root: "test.com/b", Revision: "other"},
+	}
+	if err := v.Vendor("test.com/app", deps); err != nil {
+		t.Fatalf("Vendor returned error %s", err.Error())
+	}
+	cf, err := LoadCanticleFile(v.Emit)
+	if err != nil {
+		t.Fatalf("Error loading emitted file: %s", err.Error())
+	}
+	expected := map[string]string{"test.com/a": tagged, "test.com/b": other}
+	if len(cf.Deps) != len(expected) {
+		t.Fatalf("Expected %d emitted deps got %+v", len(expected), cf.Deps)
+	}
+	for _, dep := range cf.Deps {
+		if dep.Revision != expected[dep.Root] {
+			t.Errorf("Expected %s emitted at %s got %s", dep.Root, expected[dep.Root], dep.Revision)
+		}
+	}
+}
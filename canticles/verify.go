@@ -0,0 +1,88 @@
+package canticles
+
+import (
+	"flag"
+	"fmt"
+	"log"
+)
+
+type Verify struct {
+	flags   *flag.FlagSet
+	Verbose bool
+	Scopes  ScopeFlags
+}
+
+func NewVerify() *Verify {
+	f := flag.NewFlagSet("verify", flag.ExitOnError)
+	v := &Verify{flags: f, Scopes: ScopeFlags(NewStringSet())}
+	f.BoolVar(&v.Verbose, "v", false, "Be verbose when verifying")
+	f.Var(v.Scopes, "scope", "Only verify dependencies in these comma seperated scopes (runtime, test, tool)")
+	return v
+}
+
+var verify = NewVerify()
+
+var VerifyCommand = &Command{
+	Name:             "verify",
+	UsageLine:        "verify [-v] [-scope <scopes>] [dir...]",
+	ShortDescription: "Check dependencies on disk match their locked hashes.",
+	LongDescription: `The verify command recomputes the tree hash of the revision checked out of each dependency in the Canticle.lock of the given directories, or the current directory, and fails if any does not match its locked Hash. Only committed files are hashed, so VCS metadata, uncommitted changes, untracked files and line ending conversions are not part of the hash. Dependencies without VCS metadata, such as archives, have the files on disk hashed. Dependencies without a Hash are not checked. Nothing is fetched or checked out, run get first.
+
+Specify -v to print out a verbose set of operations instead of just errors.
+
+Specify -scope to only verify dependencies in the comma seperated scopes given, as with get.`,
+	Flags: verify.flags,
+	Cmd:   verify,
+}
+
+// Run the verify command.
+func (v *Verify) Run(args []string) {
+	if v.Verbose {
+		Verbose = true
+	}
+	defer func() { Verbose = false }()
+
+	gopath, err := EnvGoPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := 0
+	for _, dir := range ParseCmdLinePackages(v.flags.Args()) {
+		errs := v.VerifyPath(gopath, dir)
+		for _, err := range errs {
+			fmt.Println(err.Error())
+		}
+		failed += len(errs)
+	}
+	if failed > 0 {
+		log.Fatalf("cant verify %d dependencies", failed)
+	}
+}
+
+// VerifyPath checks the hash of every locked dependency of the
+// package at path, returning an error for each that does not match.
+func (v *Verify) VerifyPath(gopath, path string) []error {
+	pkg, err := PackageName(gopath, path)
+	if err != nil {
+		return []error{err}
+	}
+	reader := &DepReader{Gopath: gopath}
+	cdeps, err := reader.LockedDependencies(pkg)
+	if err != nil {
+		return []error{fmt.Errorf("cant verify %s without a Canticle.lock %s", pkg, err.Error())}
+	}
+	var errs []error
+	for _, cdep := range cdeps {
+		switch {
+		case !cdep.InScopes(StringSet(v.Scopes)):
+			LogVerbose("Skipping %s dep %s", cdep.DepScope(), cdep.Root)
+		case cdep.Hash == "":
+			LogVerbose("Not verifying %s, no hash locked", cdep.Root)
+		default:
+			if err := VerifyHash(gopath, cdep); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}